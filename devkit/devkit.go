@@ -1,11 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"math"
+	"nxtchain/configmanager"
 	"nxtchain/nxtblock"
+	"nxtchain/nxtutxodb"
 	"sort"
 	"strings"
 	"time"
@@ -14,22 +18,27 @@ import (
 func main() {
 	fmt.Println("NXTChain DevKit v0.1 - © NXTCrypto 2025\n---------------------------------------")
 
-	mode := flag.String("mode", "", "Mode to use for running the devkit. Options: block, genesis, difficulty, check")
+	mode := flag.String("mode", "", "Mode to use for running the devkit. Options: block, genesis, difficulty, check, reindex, verifychain, export, import, encoding")
 	parts := flag.String("parts", "", "Block ID parts used for checking. Required for check mode, redundant for other modes.")
+	blockdir := flag.String("blockdir", "blocks", "Block directory used for reindex, verifychain, export and import mode.")
+	utxodir := flag.String("utxodir", "utxodb", "UTXO database directory used for reindex, verifychain and import mode.")
+	file := flag.String("file", "chain.nxtarch", "Archive file used for export and import mode.")
 	flag.Parse()
 
+	ruleset := LoadRuleSet()
+
 	if *mode == "" {
-		fmt.Print("OPTIONS:\n0. GEN GENESIS BLOCK\n1. GEN BLOCK\n2. Difficulty Adjustment\n3. Block ID check\n4. NXT CONVERTER TEST\n\nEnter option: ")
+		fmt.Print("OPTIONS:\n0. GEN GENESIS BLOCK\n1. GEN BLOCK\n2. Difficulty Adjustment\n3. Block ID check\n4. NXT CONVERTER TEST\n5. REINDEX CHAIN\n6. VERIFY CHAIN\n7. EXPORT CHAIN\n8. IMPORT CHAIN\n9. ENCODING CHECK\n\nEnter option: ")
 		var option int
 		fmt.Scanln(&option)
 
 		switch option {
 		case 0:
-			GGB()
+			GGB(ruleset)
 		case 1:
-			GB()
+			GB(ruleset)
 		case 2:
-			DFBC(10)
+			DFBC(10, ruleset)
 		case 3:
 			var strparts string
 			fmt.Println("Enter blockid parts:")
@@ -40,29 +49,54 @@ func main() {
 				fmt.Println("NXT AMOUNT: ")
 				var amount int64
 				fmt.Scanln(&amount)
-				fmt.Println("Converted:", nxtblock.ConvertAmount(amount))
-				fmt.Println("FLOAT AMOUNT: ")
-				var amount2 float64
+				fmt.Println("Converted:", nxtblock.Amount(amount), " NXT")
+				fmt.Println("DECIMAL AMOUNT: ")
+				var amount2 string
 				fmt.Scanln(&amount2)
-				fmt.Println("Converted:", nxtblock.ConvertAmountBack(amount2), " NXT")
+				converted, err := nxtblock.ParseAmount(amount2)
+				if err != nil {
+					fmt.Println("Error:", err)
+					continue
+				}
+				fmt.Println("Converted:", int64(converted))
 			}
+		case 5:
+			RIDX(ruleset, *blockdir, *utxodir, false)
+		case 6:
+			RIDX(ruleset, *blockdir, *utxodir, true)
+		case 7:
+			EXPC(*blockdir, *file)
+		case 8:
+			IMPC(ruleset, *blockdir, *utxodir, *file)
+		case 9:
+			ENCC(*blockdir)
 		default:
 			fmt.Println("Invalid option")
 		}
 	} else {
 		switch *mode {
 		case "block":
-			GB()
+			GB(ruleset)
 		case "genesis":
-			GGB()
+			GGB(ruleset)
 		case "difficulty":
-			DFBC(10)
+			DFBC(10, ruleset)
 		case "check":
 			if strings.TrimSpace(*parts) == "" {
 				fmt.Println("Please define block ID parts. Do this by passing -parts flag.")
 				return
 			}
 			BIDC(*parts)
+		case "reindex":
+			RIDX(ruleset, *blockdir, *utxodir, false)
+		case "verifychain":
+			RIDX(ruleset, *blockdir, *utxodir, true)
+		case "export":
+			EXPC(*blockdir, *file)
+		case "import":
+			IMPC(ruleset, *blockdir, *utxodir, *file)
+		case "encoding":
+			ENCC(*blockdir)
 		default:
 			fmt.Println("Invalid mode")
 		}
@@ -70,20 +104,126 @@ func main() {
 
 }
 
+// LoadRuleSet reads the ruleset from config.json in the working directory (the same file the
+// node and miner use) and falls back to the default ruleset without one.
+func LoadRuleSet() nxtblock.RuleSet {
+	config, err := configmanager.LoadConfig()
+	if err != nil {
+		fmt.Println("No config.json found, using the default ruleset")
+		return nxtblock.DefaultRuleSet()
+	}
+	value, exists := config.Fields["ruleset"]
+	if !exists {
+		fmt.Println("No ruleset in config.json, using the default ruleset")
+		return nxtblock.DefaultRuleSet()
+	}
+	ruleset, err := nxtblock.ParseRuleSet(value)
+	if err != nil {
+		fmt.Println("Error reading ruleset, using the default ruleset:", err)
+		return nxtblock.DefaultRuleSet()
+	}
+	return ruleset
+}
+
 func BIDC(strparts string) {
 	// BLOCK ID CHECKER
 	blockID := fmt.Sprintf("%x", sha256.Sum256([]byte(strparts)))
 	fmt.Println("Block ID:", blockID)
 }
-func GGB() {
-	fmt.Println("Generating genesis block...")
+func RIDX(ruleset nxtblock.RuleSet, blockdir string, utxodir string, verifyOnly bool) {
+	// REINDEX / VERIFY CHAIN
+	if err := nxtutxodb.Open(utxodir); err != nil {
+		fmt.Println("Error opening UTXO database:", err)
+		return
+	}
+
+	start := time.Now()
+	var result nxtblock.ReindexResult
+	var matches bool
+	var err error
+	if verifyOnly {
+		fmt.Println("Verifying chain in", blockdir, "...")
+		result, matches, err = nxtblock.VerifyChain(blockdir, ruleset)
+	} else {
+		fmt.Println("Reindexing chain in", blockdir, "...")
+		result, err = nxtblock.Reindex(blockdir, ruleset)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	fmt.Printf("\n-- Done! (%s) - %d valid blocks, tip %s (height %d)\n", time.Since(start), result.Blocks, result.Tip.Hash, result.Tip.Height)
+	if result.InvalidHash != "" {
+		fmt.Printf("First invalid block: %s (height %d)\n\t%v\n", result.InvalidHash, result.InvalidHeight, result.InvalidError)
+	}
+	fmt.Println("UTXO commitment:", result.Commitment)
+	if verifyOnly {
+		fmt.Println("Matches UTXO database:", matches)
+	} else {
+		fmt.Println("Saved:", utxodir)
+	}
+}
 
-	ruleset := nxtblock.RuleSet{
-		Difficulty:      6,
-		MaxTransactions: 10,
-		Version:         0,
-		InitialReward:   5000000000000,
+func EXPC(blockdir string, file string) {
+	// EXPORT CHAIN
+	start := time.Now()
+	fmt.Println("Exporting chain in", blockdir, "to", file, "...")
+	header, err := nxtblock.ExportChain(blockdir, file)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
 	}
+	fmt.Printf("\n-- Done! (%s) - %d blocks, tip %s (height %d)\n", time.Since(start), header.Blocks, header.TipHash, header.TipHeight)
+}
+
+func IMPC(ruleset nxtblock.RuleSet, blockdir string, utxodir string, file string) {
+	// IMPORT CHAIN
+	if err := nxtutxodb.Open(utxodir); err != nil {
+		fmt.Println("Error opening UTXO database:", err)
+		return
+	}
+	if _, err := nxtblock.RecoverBlockStore(blockdir); err != nil {
+		fmt.Println("Error recovering block store:", err)
+		return
+	}
+
+	start := time.Now()
+	fmt.Println("Importing", file, "into", blockdir, "...")
+	header, imported, err := nxtblock.ImportChain(blockdir, file, ruleset)
+	if err != nil {
+		fmt.Println("Error:", err)
+	}
+	fmt.Printf("\n-- Done! (%s) - %d of %d blocks imported, archive tip %s (height %d)\n", time.Since(start), imported, header.Blocks, header.TipHash, header.TipHeight)
+}
+
+func ENCC(blockdir string) {
+	// ENCODING CHECK (binary round trip of all local blocks, size compared to JSON)
+	blocks, err := nxtblock.GetAllBlocks(blockdir)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	var jsonSize, binarySize, failed int
+	for _, block := range blocks {
+		jsonData, _ := json.Marshal(block)
+		binaryData := nxtblock.EncodeBlock(block)
+		jsonSize += len(jsonData)
+		binarySize += len(binaryData)
+
+		decoded, err := nxtblock.DecodeBlock(binaryData)
+		decodedJSON, _ := json.Marshal(decoded)
+		if err != nil || !bytes.Equal(nxtblock.EncodeBlock(decoded), binaryData) || decoded.Hash != block.Hash || len(decodedJSON) == 0 {
+			fmt.Printf("Round trip failed for block %s (height %d): %v\n", block.Hash, block.BlockHeight, err)
+			failed++
+		}
+	}
+	fmt.Printf("\n-- Done! %d blocks, %d failed, JSON %d bytes, binary %d bytes\n", len(blocks), failed, jsonSize, binarySize)
+}
+
+func GGB(ruleset nxtblock.RuleSet) {
+	fmt.Println("Generating genesis block...")
+
 	genesisBlock := nxtblock.Block{
 		Id:           "0",
 		Timestamp:    0,
@@ -132,15 +272,9 @@ func GGB() {
 
 }
 
-func GB() {
+func GB(ruleset nxtblock.RuleSet) {
 	fmt.Println("Generating block...")
 
-	ruleset := nxtblock.RuleSet{
-		Difficulty:      6,
-		MaxTransactions: 10,
-		Version:         0,
-		InitialReward:   5000000000000,
-	}
 	// genesisBlock := nxtblock.Block{
 	// 	Id:           "0",
 	// 	Timestamp:    0,
@@ -182,6 +316,11 @@ func GB() {
 			},
 		},
 	}
+	ruleset.Bits, err = nxtblock.GetNextBlockBits("blocks", lblock, ruleset)
+	if err != nil {
+		fmt.Println("Error calculating target:", err)
+		return
+	}
 	start := time.Now()
 	block, err := nxtblock.NewBlock(transactions, ruleset, "0xMINER", "NXT", "DATA", lblock)
 	if err != nil {
@@ -194,7 +333,7 @@ func GB() {
 
 }
 
-func DFBC(target float64) {
+func DFBC(target float64, ruleset nxtblock.RuleSet) {
 	blocks, err := nxtblock.GetLatestBlocks("blocks", 10)
 	if err != nil {
 		fmt.Println("Error getting latest blocks")
@@ -222,6 +361,13 @@ func DFBC(target float64) {
 		direction = "TARGET"
 	}
 	fmt.Printf("Difficulty should %s\n", direction)
+
+	// ? Konsens-Target des nächsten Blocks (LWMA über die Vorgänger des Tips)
+	if tip, err := nxtblock.GetLatestBlock("blocks", false); err == nil {
+		if bits, err := nxtblock.GetNextBlockBits("blocks", tip, ruleset); err == nil {
+			fmt.Printf("Next block target: %08x (tip: %08x)\n", bits, tip.Ruleset.Bits)
+		}
+	}
 }
 
 func CheckBlockTimestampForDifficulty(blocks []*nxtblock.Block) float64 {
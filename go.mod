@@ -9,6 +9,6 @@ require (
 
 require (
 	github.com/mr-tron/base58 v1.2.0
-	golang.org/x/crypto v0.11.0 // indirect
+	golang.org/x/crypto v0.11.0
 	golang.org/x/sys v0.10.0 // indirect
 )
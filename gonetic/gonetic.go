@@ -15,6 +15,15 @@ import (
 
 type OutputFunc func(string)
 
+// HandshakeFunc returns the data sent to every new connection as HELLO_<data>
+type HandshakeFunc func() string
+
+// PeerOutputFunc receives a message together with the connection it arrived on (remote address)
+type PeerOutputFunc func(peerID string, message string)
+
+// DisconnectFunc is called with the remote address of every closed connection
+type DisconnectFunc func(peerID string)
+
 type Peer struct {
 	Port           string
 	connString     string
@@ -22,6 +31,10 @@ type Peer struct {
 	connectedPeers sync.Map
 	listener       net.Listener
 	Output         OutputFunc
+	Handshake      HandshakeFunc
+	PeerOutput     PeerOutputFunc
+	Disconnected   DisconnectFunc
+	handshakes     sync.Map
 	stopChan       chan struct{}
 	wg             sync.WaitGroup
 }
@@ -144,12 +157,26 @@ func (p *Peer) askForPeers(conn net.Conn) {
 	}
 }
 
+func (p *Peer) sendHandshake(conn net.Conn) {
+	if p.Handshake == nil {
+		return
+	}
+	if err := p.Send(conn, "HELLO_"+p.Handshake()); err != nil {
+		log.Printf("Error sending handshake to %s: %s", conn.RemoteAddr().String(), err)
+	}
+}
+
 func (p *Peer) handleConnection(conn net.Conn) {
 	defer func() {
 		p.connectedPeers.Delete(conn.RemoteAddr().String())
+		p.handshakes.Delete(conn.RemoteAddr().String())
 		conn.Close()
+		if p.Disconnected != nil {
+			p.Disconnected(conn.RemoteAddr().String())
+		}
 	}()
 	p.askForPeers(conn)
+	p.sendHandshake(conn)
 	reader := bufio.NewReader(conn)
 	for {
 		messageOrig, err := reader.ReadString('\n')
@@ -163,6 +190,8 @@ func (p *Peer) handleConnection(conn net.Conn) {
 				peers := append(p.GetConnectedPeers(), p.GetConnString())
 				p.Send(conn, "NEW_PEERS_"+strings.Join(peers, ";"))
 			}
+		} else if strings.HasPrefix(message, "HELLO_") {
+			p.handshakes.Store(conn.RemoteAddr().String(), strings.TrimPrefix(message, "HELLO_"))
 		} else if strings.HasPrefix(message, "ERROR_") {
 			fmt.Println(strings.Split(message, "_")[1])
 
@@ -183,7 +212,11 @@ func (p *Peer) handleConnection(conn net.Conn) {
 			}
 		} else {
 			if message != "PING" {
-				p.Output(messageOrig)
+				if p.PeerOutput != nil {
+					p.PeerOutput(conn.RemoteAddr().String(), messageOrig)
+				} else {
+					p.Output(messageOrig)
+				}
 			}
 		}
 	}
@@ -301,3 +334,12 @@ func (p *Peer) GetConnectedPeers() []string {
 func (p *Peer) GetConnString() string {
 	return p.connString
 }
+
+// GetPeerHandshake returns the handshake data a connected peer sent, if any
+func (p *Peer) GetPeerHandshake(peerID string) (string, bool) {
+	data, exists := p.handshakes.Load(peerID)
+	if !exists {
+		return "", false
+	}
+	return data.(string), true
+}
@@ -1,15 +1,16 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"math"
 	"nxtchain/clitools"
 	"nxtchain/configmanager"
 	"nxtchain/gonetic"
 	"nxtchain/nextutils"
 	"nxtchain/nxtblock"
 	"nxtchain/nxtutxodb"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -23,16 +24,19 @@ import (
 var version string = "0.0.0"
 var devmode bool = true
 var blockHeightCounts = make(map[int]int)
-var utxodbs = make(map[string]map[string]nxtutxodb.UTXO)
+var utxoHashes = make(map[string]nxtblock.UTXOState)
+var selectedUTXOState nxtblock.UTXOState
+var utxoHashSelected bool
 var totalResponses int
 var totalUDBresponses int
 var blockdir string = "blocks"
+var utxodir string = "utxodb"
+var utxoVerified bool
 var remainingBlockHeights int
 var remainingDBs int
 var tick int = 5
 var minerWallet string
 var minerCurrency string
-var timeTargetMin float64 = 10
 
 // * CONFIG * //
 var config configmanager.Config
@@ -80,7 +84,9 @@ func start(peer *gonetic.Peer) {
 		if len(peer.GetConnectedPeers()) > 0 {
 			nextutils.Debug("%s", "Starting syncronization...")
 			nextutils.Debug("%s", "Syncing Blockchain...")
-			syncUTXODB(peer)
+			if !utxoVerified {
+				syncUTXODB(peer)
+			}
 			syncBlockchain(peer)
 			nextutils.Debug("%s", "Syncronization complete.")
 			fmt.Println("+- SYNC COMPLETE -")
@@ -122,27 +128,30 @@ func start(peer *gonetic.Peer) {
 				}
 
 				transactionMap := nxtblock.GetAllTransactionsFromPool()
-				transactions := make([]nxtblock.Transaction, 0, len(transactionMap))
+				pool := make([]nxtblock.Transaction, 0, len(transactionMap))
 				for _, tx := range transactionMap {
-					transactions = append(transactions, tx)
+					pool = append(pool, tx)
 				}
-				allblocks, err := nxtblock.GetAllBlocks(blockdir)
+
+				// * Target des nächsten Blocks (Retargeting aus den Vorgängern)
+				blockRuleset := ruleset
+				blockRuleset.Bits, err = nxtblock.GetNextBlockBits(blockdir, latestBlock, ruleset)
 				if err != nil {
-					nextutils.Error("Error getting all blocks: %v", err)
-					return
-				}
-				if len(allblocks)%10 == 0 {
-					adjustDifficulty()
-				} else {
-					nextutils.Debug("%s", "No need to adjust difficulty")
+					nextutils.Error("Error calculating target: %v", err)
+					continue
 				}
 
+				// * Transaktionen nach Gebührenrate wählen (MaxTransactions, MaxBlockSize)
+				transactions := nxtblock.SelectBlockTransactions(pool, blockRuleset, minerWallet, latestBlock)
 				if len(transactions) > 0 {
 					fmt.Println("+- Mapped transactions: ", transactions)
 				}
+				if len(transactions) < len(pool) {
+					fmt.Printf("+- %d transactions left in the mempool\n", len(pool)-len(transactions))
+				}
 
 				// * Create block
-				newBlock, err := nxtblock.NewBlock(transactions, ruleset, minerWallet, minerCurrency, "I love NXT", latestBlock)
+				newBlock, err := nxtblock.NewBlock(transactions, blockRuleset, minerWallet, minerCurrency, "I love NXT", latestBlock)
 				if err != nil {
 					nextutils.Error("Error creating new block: %v", err)
 					continue
@@ -151,32 +160,28 @@ func start(peer *gonetic.Peer) {
 				elapsed := time.Since(start)
 				fmt.Printf("\n-- Done! (%s) - %s\n", elapsed, newBlock.Hash)
 
-				// * Validate block
+				// * Validate block, update UTXO database & save block
 				nextutils.Debug("%s", "Validating new block...")
-				_, err = nxtblock.ValidatorValidateBlock(*newBlock, blockdir, ruleset)
-				if err != nil {
+				if err := nxtblock.AcceptBlock(*newBlock, blockdir, ruleset); err != nil {
 					nextutils.Error("Error validating block: %v", err)
+					// ? Ungültige Transaktionen nicht immer wieder in den nächsten Block aufnehmen
+					if removed := nxtblock.RemoveInvalidTransactionsFromPool(ruleset); removed > 0 {
+						fmt.Printf("+- Removed %d invalid transactions from the mempool\n", removed)
+					}
+					miningInProgress = false
 					continue
 				}
 
-				fmt.Printf("\n[+] BLOCK IS VALID | YOU'VE EARNED %f NXT (%d)\n", nxtblock.ConvertAmount(newBlock.HeadTransactions[0].Outputs[0].Amount), newBlock.HeadTransactions[0].Outputs[0].Amount)
+				earned := nxtblock.Amount(newBlock.HeadTransactions[0].Outputs[0].Amount)
+				blockReward := nxtblock.Amount(nxtblock.CalculateBlockReward(ruleset.InitialReward, int64(newBlock.BlockHeight)))
+				// ? Die Inputs sind nach AcceptBlock ausgegeben, die Gebühren ergeben sich aus der Head-Transaktion
+				blockFee, _ := earned.Sub(blockReward)
+				fmt.Printf("\n[+] BLOCK IS VALID | YOU'VE EARNED %s NXT (%d)\n", earned, int64(earned))
 				//show the user why the blockreward is what it is
-				fmt.Printf("-\tBlock reward: %d\n", nxtblock.CalculateBlockReward(ruleset.InitialReward, int64(newBlock.BlockHeight)))
-				fmt.Printf("-\tBlock fee: %d\n", nxtblock.CalculateBlockFee(newBlock.Transactions))
-				fmt.Printf("-\tBlock reward + fee: %d\n", nxtblock.CalculateBlockReward(ruleset.InitialReward, int64(newBlock.BlockHeight))+nxtblock.CalculateBlockFee(newBlock.Transactions))
-				fmt.Printf("-\tWhat you received: %d\n", newBlock.HeadTransactions[0].Outputs[0].Amount)
-				// * Update UTXO database
-				nxtblock.DeleteBlockUTXOs(newBlock.Transactions)
-				nxtblock.ConvertBlockToUTXO(*newBlock)
-
-				// * Save block
-				path := nxtblock.SaveBlock(*newBlock, blockdir)
-				if path == "" {
-					nextutils.Error("%s", "Error saving block")
-					continue
-				}
-
-				fmt.Println("+- Block saved: " + path)
+				fmt.Printf("-\tBlock reward: %s NXT\n", blockReward)
+				fmt.Printf("-\tBlock fee: %s NXT\n", blockFee)
+				fmt.Printf("-\tWhat you received: %s NXT\n", earned)
+				fmt.Println("+- Block saved: " + newBlock.Hash)
 
 				// * Broadcast block
 				blockStr, err := nxtblock.PrepareBlockSender(*newBlock)
@@ -214,6 +219,11 @@ func start(peer *gonetic.Peer) {
 				connected := peer.GetConnectedPeers()
 				fmt.Println("+- CONNECTED PEERS -")
 				for _, conn := range connected {
+					handshake, _ := peer.GetPeerHandshake(conn)
+					if prunedHeight := nxtblock.ParsePrunedHandshake(handshake); prunedHeight > 0 {
+						fmt.Printf("+- %s (pruned up to height %d)\n", conn, prunedHeight)
+						continue
+					}
 					fmt.Println("+- " + conn)
 				}
 			} else if strings.HasPrefix(input, "$blockheight") {
@@ -231,20 +241,18 @@ func start(peer *gonetic.Peer) {
 			} else if strings.HasPrefix(input, "$restart") {
 				start(peer)
 			} else if strings.HasPrefix(input, "$validate") {
-				blocks, err := nxtblock.GetAllBlocks(blockdir)
+				// ? Blöcke lassen sich nur in Reihenfolge gegen das jeweilige UTXO Set prüfen,
+				// ? VerifyChain baut es dafür neu auf und lässt die Datenbank unverändert
+				result, matches, err := nxtblock.VerifyChain(blockdir, ruleset)
 				if err != nil {
-					nextutils.Error("Error getting all blocks: %v", err)
+					nextutils.Error("Error validating blocks: %v", err)
 					continue
 				}
-				for _, block := range blocks {
-					nextutils.Debug("Validating block: %s P: %s", block.Hash, block.PreviousHash)
-					_, err := nxtblock.ValidatorValidateBlock(block, blockdir, ruleset)
-					if err != nil {
-						nextutils.Error("Error validating block: %v", err)
-						continue
-					}
-					nextutils.Debug("Block is valid.")
+				if result.InvalidHash != "" {
+					nextutils.Error("Block %s (height %d) is invalid: %v", result.InvalidHash, result.InvalidHeight, result.InvalidError)
+					continue
 				}
+				nextutils.Debug("%d blocks are valid, utxo database matches: %v", result.Blocks, matches)
 			}
 		} else {
 			peer.Broadcast(input)
@@ -253,7 +261,8 @@ func start(peer *gonetic.Peer) {
 }
 
 // * PEER OUTPUT HANDLER * //
-func handleEvents(event string, peer *gonetic.Peer) {
+// ? source ist die Verbindung (gonetic peerID), über die das Event ankam
+func handleEvents(event string, source string, peer *gonetic.Peer) {
 	nextutils.Debug("%s", "[PEER EVENT] "+event)
 
 	// ~ PEER EVENTS ~ //
@@ -280,6 +289,10 @@ func handleEvents(event string, peer *gonetic.Peer) {
 			blockHeight := nxtblock.GetLocalBlockHeight(blockdir)
 			peer.Broadcast("RESPONSE_BLOCKHEIGHT_" + strconv.Itoa(blockHeight))
 			nextutils.Debug("%s", "[+] Sent block height to: "+requester+" ("+strconv.Itoa(blockHeight)+")")
+		} else if strings.HasPrefix(event_body, "TIME_") {
+			requester := strings.TrimPrefix(event_body, "TIME_")
+			peer.Broadcast("RESPONSE_TIME_" + strconv.FormatInt(nxtblock.GetTimestamp(), 10) + "_" + peer.GetConnString())
+			nextutils.Debug("%s", "[+] Sent time to: "+requester)
 		} else if isBlock := strings.HasPrefix(event_body, "BLOCK_"); isBlock {
 			parts := strings.Split(event_body, "_")
 			heightStr := parts[1]
@@ -303,14 +316,34 @@ func handleEvents(event string, peer *gonetic.Peer) {
 			peer.Broadcast("RESPONSE_BLOCK_" + blockStr)
 			nextutils.Debug("%s", "[+] Sent block to: "+requester)
 
+		} else if strings.HasPrefix(event_body, "UTXOHASH_") {
+			parts := strings.Split(event_body, "_")
+			requester := ""
+			if len(parts) > 1 {
+				requester = parts[1]
+			}
+			state := nxtblock.GetUTXOState()
+			peer.Broadcast("RESPONSE_UTXOHASH_" + state.Commitment + "_" + state.Tip.Hash + "_" + strconv.Itoa(state.Tip.Height) + "_" + peer.GetConnString())
+			nextutils.Debug("%s", "[+] Sent UTXO commitment to: "+requester+" ("+state.Commitment+")")
 		} else if strings.HasPrefix(event_body, "UTXODB_") {
 			parts := strings.Split(event_body, "_")
-			requester := parts[1]
-			nextutils.Debug("%s", "Sending UTXO DB to: "+requester)
-			utxoDB := nxtutxodb.GetUTXODatabase()
-			if utxoDB == nil {
-				utxoDB = make(map[string]nxtutxodb.UTXO)
+			if len(parts) < 5 {
+				nextutils.Error("%s", "Invalid UTXODB request format")
+				return
 			}
+			hash := parts[1]
+			tipHash := parts[2]
+			target := parts[3]
+			requester := parts[4]
+			if target != peer.GetConnString() {
+				return
+			}
+			state, utxoDB := nxtblock.CopyUTXOState()
+			if hash != state.Commitment || tipHash != state.Tip.Hash {
+				nextutils.Debug("%s", "UTXO DB requested by "+requester+" does not match local commitment, not sending")
+				return
+			}
+			nextutils.Debug("%s", "Sending UTXO DB to: "+requester)
 			utxoDBStr, err := nxtblock.PrepareUTXOSender(utxoDB)
 			if err != nil {
 				nextutils.Error("Error: %v", err)
@@ -324,9 +357,7 @@ func handleEvents(event string, peer *gonetic.Peer) {
 		nextutils.Debug("%s", "[RESPONSE] "+event_body)
 
 		if strings.HasPrefix(event_body, "BLOCKHEIGHT_") {
-			heightStr := strings.TrimPrefix(event_body, "BLOCKHEIGHT_")
-			heightStr = strings.TrimSpace(heightStr)
-			blockHeight, err := strconv.Atoi(heightStr)
+			blockHeight, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(event_body, "BLOCKHEIGHT_")))
 			if err != nil {
 				nextutils.Error("Error converting block height: %v", err)
 				return
@@ -346,7 +377,7 @@ func handleEvents(event string, peer *gonetic.Peer) {
 					time.Sleep(5 * time.Second)
 					if totalResponses < remainingBlockHeights {
 						nextutils.Debug("Timeout reached, proceeding with available responses")
-						selectedHeight := getMostFrequentBlockHeight()
+						selectedHeight := getBestBlockHeight()
 						nextutils.Debug("Selected block height for sync: %d", selectedHeight)
 						startBlockchainSync(selectedHeight, peer)
 					}
@@ -354,39 +385,79 @@ func handleEvents(event string, peer *gonetic.Peer) {
 			}
 
 			if totalResponses >= remainingBlockHeights { // * ALL RESPONSES FOR A VALID * //
-				selectedHeight := getMostFrequentBlockHeight()
+				selectedHeight := getBestBlockHeight()
 				nextutils.Debug("Selected block height for sync: %d", selectedHeight)
 				startBlockchainSync(selectedHeight, peer)
 			}
 
-		} else if strings.HasPrefix(event_body, "UTXODB_") {
-			utxoDBStr := strings.TrimPrefix(event_body, "UTXODB_")
-			utxoDB, err := nxtblock.GetUTXOSender(utxoDBStr)
+		} else if strings.HasPrefix(event_body, "TIME_") {
+			parts := strings.Split(strings.TrimPrefix(event_body, "TIME_"), "_")
+			if len(parts) < 2 {
+				nextutils.Error("%s", "Invalid TIME response: "+event_body)
+				return
+			}
+			peerTime, err := strconv.ParseInt(parts[0], 10, 64)
 			if err != nil {
-				nextutils.Error("Error: %v", err)
+				nextutils.Error("Error converting peer time: %v", err)
+				return
+			}
+			nxtblock.AddTimeSample(source, peerTime)
+			nextutils.Debug("Time from %s via %s: %d (network time offset: %ds)", parts[1], source, peerTime, nxtblock.GetTimeOffset())
+		} else if strings.HasPrefix(event_body, "BLOCKPRUNED_") {
+			parts := strings.Split(strings.TrimPrefix(event_body, "BLOCKPRUNED_"), "_")
+			if len(parts) < 2 {
+				nextutils.Error("%s", "Invalid BLOCKPRUNED response: "+event_body)
+				return
+			}
+			nextutils.Debug("%s", "Peer "+parts[1]+" has pruned block at height "+parts[0]+", waiting for a full node to send it")
+		} else if strings.HasPrefix(event_body, "UTXOHASH_") {
+			parts := strings.Split(strings.TrimPrefix(event_body, "UTXOHASH_"), "_")
+			if len(parts) < 4 {
+				nextutils.Error("%s", "Invalid UTXOHASH response: "+event_body)
+				return
+			}
+			height, err := strconv.Atoi(parts[2])
+			if err != nil {
+				nextutils.Error("%s", "Invalid UTXOHASH response: "+event_body)
 				return
 			}
+			state := nxtblock.UTXOState{Commitment: parts[0], Tip: nxtutxodb.BlockRef{Hash: parts[1], Height: height}}
+			responder := parts[3]
 
-			utxodbs[peer.GetConnString()] = utxoDB
+			utxoHashes[responder] = state
 			totalUDBresponses++
 
-			nextutils.Debug("UTXO DB response from: %s (%d/%d responses)", peer.GetConnString(), totalUDBresponses, remainingDBs)
+			nextutils.Debug("UTXO commitment from: %s (%d/%d responses)", responder, totalUDBresponses, remainingDBs)
 
-			go func() {
-				time.Sleep(5 * time.Second)
-				if totalUDBresponses < remainingDBs {
-					nextutils.Debug("Timeout reached, proceeding with available UTXO DB responses")
-					selectedDB := getMostFrequentUTXODB()
-					nextutils.Debug("Selected UTXO DB for sync: %v", selectedDB)
-					nxtutxodb.SetUTXODatabase(selectedDB)
-				}
-			}()
+			if totalUDBresponses == 1 {
+				go func() {
+					time.Sleep(5 * time.Second)
+					if totalUDBresponses < remainingDBs {
+						nextutils.Debug("Timeout reached, proceeding with available UTXO commitments")
+						selectUTXODB(peer)
+					}
+				}()
+			}
 
 			if totalUDBresponses >= remainingDBs { // * ALL RESPONSES FOR A VALID * //
-				selectedDB := getMostFrequentUTXODB()
-				nextutils.Debug("Selected UTXO DB for sync: %v", selectedDB)
-				nxtutxodb.SetUTXODatabase(selectedDB)
+				selectUTXODB(peer)
+			}
+		} else if strings.HasPrefix(event_body, "UTXODB_") {
+			if selectedUTXOState.Commitment == "" {
+				return
 			}
+			utxoDBStr := strings.TrimPrefix(event_body, "UTXODB_")
+			utxoDB, err := nxtblock.GetUTXOSender(utxoDBStr)
+			if err != nil {
+				nextutils.Error("Error: %v", err)
+				return
+			}
+			if err := nxtblock.SetPeerUTXODatabase(blockdir, utxoDB, selectedUTXOState); err != nil {
+				nextutils.Error("Received UTXO DB not applied: %v", err)
+				return
+			}
+			selectedUTXOState = nxtblock.UTXOState{}
+			nextutils.Debug("UTXO DB synced (%d entries)", len(utxoDB))
 		} else if strings.HasPrefix(event_body, "BLOCK_") {
 			parts := strings.SplitN(event_body, "_", 2)
 			if len(parts) < 2 {
@@ -401,34 +472,18 @@ func handleEvents(event string, peer *gonetic.Peer) {
 			}
 
 			nextutils.Debug("%s", "Validating block (ID: "+newBlock.Id+")...")
-			valid, err := nxtblock.ValidatorValidateBlock(newBlock, blockdir, ruleset)
-			if err != nil {
+			if err := nxtblock.AcceptBlock(newBlock, blockdir, ruleset); err != nil {
+				if errors.Is(err, nxtblock.ErrOrphanBlock) {
+					nextutils.Debug("%s", "Block (ID: "+newBlock.Id+") kept as orphan until its previous block arrives.")
+					return
+				}
 				nextutils.Error("%s", "Error: Block (ID: "+newBlock.Id+") is not valid")
 				nextutils.Error("Error: %v", err)
 				return
 			}
-			if !valid {
-				nextutils.Error("%s", "Error: Block (ID: "+newBlock.Id+") is not valid")
-				return
-			}
-			nextutils.Debug("%s", "Block (ID: "+newBlock.Id+") is valid. Saving block...")
-			path := nxtblock.SaveBlock(newBlock, blockdir)
-			nextutils.Debug("%s", "Block saved: "+path)
-			nextutils.Debug("Updating UTXO database...")
-			nxtblock.DeleteBlockUTXOs(newBlock.Transactions)
-			nxtblock.ConvertBlockToUTXO(newBlock)
+			nextutils.Debug("%s", "Block (ID: "+newBlock.Id+") is valid.")
+			nextutils.Debug("Block saved and UTXO database updated.")
 
-			allblocks, err := nxtblock.GetAllBlocks(blockdir)
-			if err != nil {
-				nextutils.Error("Error getting all blocks: %v", err)
-				return
-			}
-			if len(allblocks)%10 == 0 {
-				adjustDifficulty()
-			} else {
-				nextutils.Debug("%s", "No need to adjust difficulty")
-			}
-			nextutils.Debug("UTXO database updated.")
 		}
 	case "NEW": // * NEW - NEUE OBJEKTE * //
 		parts := strings.SplitN(event_body, "_", 2)
@@ -447,11 +502,8 @@ func handleEvents(event string, peer *gonetic.Peer) {
 			}
 
 			// * VALIDATE TRANSACTION * //
-			//! TEST
-			nxtutxodb.AddUTXO("1", 0, 100000000000000, "rpiZNDkFnb7f5CnYTnoASqHHUSt1Jpn4dJLSqH4tLSw", 1, false)
-			//! -----
 			nextutils.Debug("%s", "Validating transaction (ID: "+newTransaction.ID+")...")
-			valid, err := nxtblock.ValidatorValidateTransaction(newTransaction)
+			valid, err := nxtblock.ValidatorValidateTransaction(newTransaction, ruleset)
 			if err != nil {
 				nextutils.Error("%s", "Error: Transaction (ID: "+newTransaction.ID+") is not valid")
 				nextutils.Error("Error: %v", err)
@@ -464,6 +516,11 @@ func handleEvents(event string, peer *gonetic.Peer) {
 				return
 			}
 			nextutils.Debug("%s", "Transaction (ID: "+newTransaction.ID+") is valid.")
+			if err := nxtblock.CheckRelayFee(newTransaction, nxtblock.MinRelayFeeRate); err != nil {
+				nextutils.Error("%s", "Error: Transaction (ID: "+newTransaction.ID+") rejected")
+				nextutils.Error("Error: %v", err)
+				return
+			}
 			nxtblock.AddTransactionToPool(newTransaction)
 			fmt.Println("[+] Added transaction: #" + newTransaction.ID + " to the mempool")
 			nextutils.Debug("%s", "Mempool size: "+strconv.Itoa(len(nxtblock.GetAllTransactionsFromPool())))
@@ -475,25 +532,18 @@ func handleEvents(event string, peer *gonetic.Peer) {
 			}
 
 			nextutils.Debug("%s", "Validating block (ID: "+newBlock.Id+")...")
-			valid, err := nxtblock.ValidatorValidateBlock(newBlock, blockdir, ruleset)
-			if err != nil {
+			if err := nxtblock.AcceptBlock(newBlock, blockdir, ruleset); err != nil {
+				if errors.Is(err, nxtblock.ErrOrphanBlock) {
+					nextutils.Debug("%s", "Block (ID: "+newBlock.Id+") kept as orphan until its previous block arrives.")
+					return
+				}
 				nextutils.Error("%s", "Error: Block (ID: "+newBlock.Id+") is not valid")
 				nextutils.Error("Error: %v", err)
 				return
 			}
-			if !valid {
-				nextutils.Error("%s", "Error: Block (ID: "+newBlock.Id+") is not valid")
-				return
-			}
 			nextutils.Debug("%s", "Block (ID: "+newBlock.Id+") is valid.")
 			fmt.Println("Block (ID: " + newBlock.Id + ") is valid.")
-			nextutils.Debug("Saving block...")
-			path := nxtblock.SaveBlock(newBlock, blockdir)
-			nextutils.Debug("%s", "Block saved: "+path)
-			nextutils.Debug("Updating UTXO database...")
-			nxtblock.DeleteBlockUTXOs(newBlock.Transactions)
-			nxtblock.ConvertBlockToUTXO(newBlock)
-			nextutils.Debug("UTXO database updated.")
+			nextutils.Debug("Block saved and UTXO database updated.")
 		default:
 			nextutils.Debug("%s", "Unknown new object: "+newObject)
 		}
@@ -514,6 +564,8 @@ func syncBlockchain(peer *gonetic.Peer) {
 	// * DIE anderen peers schicken die blöcke zurück privat an dich zurück
 
 	peer.Broadcast("RGET_BLOCKHEIGHT_" + peer.GetConnString())
+	// ? Uhrzeit der Peers für die Netzwerkzeit (Zeitstempel-Regeln der Blöcke)
+	peer.Broadcast("RGET_TIME_" + peer.GetConnString())
 
 }
 func startBlockchainSync(selectedHeight int, peer *gonetic.Peer) {
@@ -535,12 +587,12 @@ func startBlockchainSync(selectedHeight int, peer *gonetic.Peer) {
 		nextutils.Debug("Local blockchain is ahead or equal to network height. No sync needed.")
 	}
 }
-func getMostFrequentBlockHeight() int {
-	var maxHeight, maxCount int
-	for height, count := range blockHeightCounts {
-		if count > maxCount {
+func getBestBlockHeight() int {
+	// ? Bis zur höchsten gemeldeten Höhe laden, welche Kette gilt entscheidet die kumulierte Arbeit
+	var maxHeight int
+	for height := range blockHeightCounts {
+		if height > maxHeight {
 			maxHeight = height
-			maxCount = count
 		}
 	}
 	return maxHeight
@@ -550,87 +602,55 @@ func getMostFrequentBlockHeight() int {
 
 func syncUTXODB(peer *gonetic.Peer) {
 	nextutils.Debug("%s", "Syncing UTXO DB...")
-	// ? Broadcasten und alle UTXO datenbanken hashen, der meiste hash gewinnt und wird dann gesetzt
+	// ? Zuerst nur die Commitment-Hashes abfragen, das komplette Set wird danach nur von
+	// ? einem Peer geladen, dessen Hash und Tip der Mehrheit entsprechen
+	utxoHashes = make(map[string]nxtblock.UTXOState)
+	totalUDBresponses = 0
+	utxoHashSelected = false
 	remainingDBs = len(peer.GetConnectedPeers())
-	peer.Broadcast("RGET_UTXODB_" + peer.GetConnString())
+	peer.Broadcast("RGET_UTXOHASH_" + peer.GetConnString())
 
 }
-func compareMaps(m1, m2 map[string]nxtutxodb.UTXO) bool {
-	if len(m1) != len(m2) {
-		return false
-	}
-	for k, v1 := range m1 {
-		v2, ok := m2[k]
-		if !ok || v1 != v2 {
-			return false
-		}
+func getMostFrequentUTXOHash() (nxtblock.UTXOState, []string) {
+	counts := make(map[nxtblock.UTXOState]int)
+	for _, state := range utxoHashes {
+		counts[state]++
 	}
-	return true
-}
-
-func getMostFrequentUTXODB() map[string]nxtutxodb.UTXO {
-	var maxDB map[string]nxtutxodb.UTXO
+	var maxState nxtblock.UTXOState
 	var maxCount int
-	for _, utxoDB := range utxodbs {
-		count := 0
-		for _, db := range utxodbs {
-			if compareMaps(db, utxoDB) {
-				count++
-			}
-		}
-		if count > maxCount {
-			maxDB = utxoDB
+	for state, count := range counts {
+		if count > maxCount || (count == maxCount && state.Commitment < maxState.Commitment) {
+			maxState = state
 			maxCount = count
 		}
 	}
-	return maxDB
+	var holders []string
+	for conn, state := range utxoHashes {
+		if state == maxState {
+			holders = append(holders, conn)
+		}
+	}
+	sort.Strings(holders)
+	return maxState, holders
 }
 
-// * DIFFICULTY ADJUSTER * //
-
-func adjustDifficulty() {
-	nextutils.Debug("%s", "Adjusting difficulty...")
-	// ? Calculate average time between blocks
-	// ? Compare to target time
-	// ? Adjust difficulty
-
-	lblocks, err := nxtblock.GetLatestBlocks(blockdir, 20)
-	if err != nil {
-		nextutils.Error("Error getting latest blocks: %v", err)
+func selectUTXODB(peer *gonetic.Peer) {
+	if utxoHashSelected {
 		return
 	}
-	blockPtrs := make([]*nxtblock.Block, len(lblocks))
-	for i := range lblocks {
-		blockPtrs[i] = &lblocks[i]
-	}
+	utxoHashSelected = true
 
-	avgTime := nxtblock.CheckBlockTimestampForDifficulty(blockPtrs)
-	if avgTime == 0 {
-		nextutils.Error("%s", "Not enough blocks to calculate difficulty")
+	state, holders := getMostFrequentUTXOHash()
+	if len(holders) == 0 {
 		return
 	}
-
-	nextutils.Debug("Average time between blocks: %f", avgTime)
-	nextutils.Debug("Target time: %f", timeTargetMin)
-	avgTime = math.Round(avgTime)
-	valid := avgTime < timeTargetMin || avgTime > timeTargetMin
-	nextutils.Debug("Need to change difficulty? %t", valid)
-	direction := "increase"
-	if avgTime > timeTargetMin+1 {
-		direction = "decrease"
-		ruleset.Difficulty--
-		configmanager.SetItem("ruleset", ruleset, &config, true)
-	} else if math.Abs(avgTime-timeTargetMin) <= 1 {
-		direction = "do nothing"
-	}
-	if direction == "increase" {
-		ruleset.Difficulty++
-		configmanager.SetItem("ruleset", ruleset, &config, true)
-
+	nextutils.Debug("Selected UTXO commitment for sync: %s at %s (height %d) (%d/%d peers)", state.Commitment, state.Tip.Hash, state.Tip.Height, len(holders), len(utxoHashes))
+	if state == nxtblock.GetUTXOState() {
+		nextutils.Debug("%s", "Local UTXO DB already matches the selected commitment.")
+		return
 	}
-	configmanager.SaveConfig(config)
-	nextutils.Debug("Difficulty should %s", direction)
-	nextutils.Debug("New difficulty: %d", ruleset.Difficulty)
+	selectedUTXOState = state
+	peer.Broadcast("RGET_UTXODB_" + state.Commitment + "_" + state.Tip.Hash + "_" + holders[0] + "_" + peer.GetConnString())
 }
 
 // * PEER TO PEER * //
@@ -645,8 +665,8 @@ func createPeer(seedNode string) {
 	}
 
 	var peer *gonetic.Peer
-	peerOutput := func(event string) {
-		go handleEvents(event, peer)
+	peerOutput := func(source string, event string) {
+		go handleEvents(event, source, peer)
 	}
 
 	defaultPortStr := config.Fields["default_port"].(string)
@@ -678,11 +698,16 @@ func createPeer(seedNode string) {
 	if default_port != 0 {
 		port = strconv.Itoa(default_port)
 	}
-	peer, err = gonetic.NewPeer(peerOutput, maxConnections, port)
+	peer, err = gonetic.NewPeer(nil, maxConnections, port)
 	if err != nil {
 		nextutils.Error("Error creating peer: %v", err)
 		return
 	}
+	peer.PeerOutput = peerOutput
+	peer.Disconnected = nxtblock.RemoveTimeSample
+	peer.Handshake = func() string {
+		return nxtblock.PrunedHandshake(blockdir)
+	}
 	nextutils.Debug("%s", "Peer created. Starting peer...")
 	nextutils.Debug("%s", "Max connections: "+strconv.Itoa(maxConnections))
 	port = peer.Port
@@ -732,6 +757,22 @@ func startup(debug *bool, withFile *bool) {
 		nextutils.Error("Error setting block_dir: %v", err)
 		return
 	}
+	if err := configmanager.SetItem("block_store", nxtblock.BlockStoreJSON, &config, true); err != nil {
+		nextutils.Error("Error setting block_store: %v", err)
+		return
+	}
+	if err := configmanager.SetItem("utxo_dir", "utxodb", &config, true); err != nil {
+		nextutils.Error("Error setting utxo_dir: %v", err)
+		return
+	}
+	if err := configmanager.SetItem("utxo_snapshot_interval", float64(100), &config, true); err != nil {
+		nextutils.Error("Error setting utxo_snapshot_interval: %v", err)
+		return
+	}
+	if err := configmanager.SetItem("min_relay_fee_rate", float64(nxtblock.DefaultMinRelayFeeRate), &config, true); err != nil {
+		nextutils.Error("Error setting min_relay_fee_rate: %v", err)
+		return
+	}
 	if err := configmanager.SetItem("tick", float64(5), &config, true); err != nil {
 		nextutils.Error("Error setting block_dir: %v", err)
 		return
@@ -752,12 +793,7 @@ func startup(debug *bool, withFile *bool) {
 		nextutils.Error("Error setting max_connections: %v", err)
 		return
 	}
-	if err := configmanager.SetItem("ruleset", nxtblock.RuleSet{
-		Difficulty:      6,
-		MaxTransactions: 10,
-		Version:         0,
-		InitialReward:   5000000000000,
-	}, &config, true); err != nil {
+	if err := configmanager.SetItem("ruleset", nxtblock.DefaultRuleSet(), &config, true); err != nil {
 		nextutils.Error("Error setting ruleset: %v", err)
 		return
 	}
@@ -769,6 +805,39 @@ func startup(debug *bool, withFile *bool) {
 	if config.Fields["block_dir"] != nil {
 		blockdir = config.Fields["block_dir"].(string)
 	}
+	if config.Fields["block_store"] != nil {
+		if _, err := nxtblock.OpenBlockStore(blockdir, config.Fields["block_store"].(string)); err != nil {
+			nextutils.Error("Error opening block store: %v", err)
+			return
+		}
+	}
+	if config.Fields["utxo_dir"] != nil {
+		utxodir = config.Fields["utxo_dir"].(string)
+	}
+	if config.Fields["utxo_snapshot_interval"] != nil {
+		nxtutxodb.SnapshotInterval = int(config.Fields["utxo_snapshot_interval"].(float64))
+	}
+	if rate, ok := config.Fields["min_relay_fee_rate"].(float64); ok && rate >= 0 {
+		nxtblock.MinRelayFeeRate = nxtblock.Amount(rate)
+	}
+	if err := nxtutxodb.Open(utxodir); err != nil {
+		nextutils.Error("Error opening UTXO database: %v", err)
+		return
+	}
+	repaired, err := nxtblock.RecoverBlockStore(blockdir)
+	if err != nil {
+		nextutils.Error("Error recovering block store: %v", err)
+		return
+	}
+	for _, hash := range repaired {
+		nextutils.Info("Repaired half-applied block %s", hash)
+	}
+	if err := nxtblock.VerifyUTXODatabase(blockdir); err != nil {
+		nextutils.Info("Local UTXO database not verified, syncing from peers: %v", err)
+	} else {
+		utxoVerified = true
+		nextutils.Info("Local UTXO database verified at height %d", nxtutxodb.Tip().Height)
+	}
 	if config.Fields["tick"] != nil {
 		tick = int(config.Fields["tick"].(float64))
 	}
@@ -789,7 +858,11 @@ func startup(debug *bool, withFile *bool) {
 		}
 	}
 
-	ruleset = config.Fields["ruleset"].(nxtblock.RuleSet)
+	ruleset, err = nxtblock.ParseRuleSet(config.Fields["ruleset"])
+	if err != nil {
+		nextutils.Error("Error reading ruleset: %v", err)
+		return
+	}
 
 	nextutils.PrintLogo("V "+version+" - (c) 2025 NXTCHAIN. All rights reserved.\n-> MINER APPLICATION", devmode)
 }
@@ -0,0 +1,166 @@
+package nextutils
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// * BINARY ENCODER * //
+// ? Grundbausteine der Binärkodierung: Ganzzahlen als (zigzag) Varint, Strings und Bytes mit
+// ? vorangestellter Länge, bool als ein Byte. Die Reihenfolge der Felder legt der Aufrufer fest.
+// ? Jedes eigenständig kodierte Objekt beginnt mit EncodingVersion.
+
+const EncodingVersion byte = 1
+
+type Encoder struct {
+	buf []byte
+}
+
+func (e *Encoder) Bytes() []byte {
+	return e.buf
+}
+
+func (e *Encoder) PutByte(value byte) {
+	e.buf = append(e.buf, value)
+}
+
+func (e *Encoder) PutUvarint(value uint64) {
+	e.buf = binary.AppendUvarint(e.buf, value)
+}
+
+func (e *Encoder) PutVarint(value int64) {
+	e.buf = binary.AppendVarint(e.buf, value)
+}
+
+func (e *Encoder) PutBool(value bool) {
+	if value {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *Encoder) PutBytes(value []byte) {
+	e.PutUvarint(uint64(len(value)))
+	e.buf = append(e.buf, value...)
+}
+
+func (e *Encoder) PutString(value string) {
+	e.PutUvarint(uint64(len(value)))
+	e.buf = append(e.buf, value...)
+}
+
+// * BINARY DECODER * //
+// ? Gegenstück zum Encoder. Der erste Fehler bleibt gespeichert, alle weiteren Lesevorgänge
+// ? liefern dann Nullwerte, geprüft wird einmal am Ende mit Err/Finish.
+
+type Decoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func NewDecoder(data []byte) *Decoder {
+	return &Decoder{data: data}
+}
+
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// ? Prüft, dass alle Bytes gelesen wurden (keine Daten hinter dem Objekt)
+func (d *Decoder) Finish() error {
+	if d.err == nil && d.pos != len(d.data) {
+		d.err = fmt.Errorf("%d unexpected trailing bytes", len(d.data)-d.pos)
+	}
+	return d.err
+}
+
+func (d *Decoder) fail(format string, args ...any) {
+	if d.err == nil {
+		d.err = fmt.Errorf("offset %d: %s", d.pos, fmt.Sprintf(format, args...))
+	}
+}
+
+func (d *Decoder) Byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if d.pos >= len(d.data) {
+		d.fail("unexpected end of data")
+		return 0
+	}
+	value := d.data[d.pos]
+	d.pos++
+	return value
+}
+
+func (d *Decoder) Uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	value, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		d.fail("invalid uvarint")
+		return 0
+	}
+	d.pos += n
+	return value
+}
+
+func (d *Decoder) Varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	value, n := binary.Varint(d.data[d.pos:])
+	if n <= 0 {
+		d.fail("invalid varint")
+		return 0
+	}
+	d.pos += n
+	return value
+}
+
+func (d *Decoder) Bool() bool {
+	switch d.Byte() {
+	case 0:
+		return false
+	case 1:
+		return true
+	default:
+		d.fail("invalid bool")
+		return false
+	}
+}
+
+// ? Anzahl von Elementen einer Liste. Jedes Element belegt mindestens ein Byte, größere Werte
+// ? können nicht stimmen und würden nur unnötig Speicher reservieren.
+func (d *Decoder) Count() int {
+	count := d.Uvarint()
+	if count > uint64(len(d.data)-d.pos) {
+		d.fail("count %d exceeds remaining data", count)
+		return 0
+	}
+	return int(count)
+}
+
+func (d *Decoder) Bytes() []byte {
+	length := d.Count()
+	if d.err != nil || length == 0 {
+		return nil
+	}
+	value := make([]byte, length)
+	copy(value, d.data[d.pos:d.pos+length])
+	d.pos += length
+	return value
+}
+
+func (d *Decoder) String() string {
+	length := d.Count()
+	if d.err != nil {
+		return ""
+	}
+	value := string(d.data[d.pos : d.pos+length])
+	d.pos += length
+	return value
+}
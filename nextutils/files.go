@@ -0,0 +1,87 @@
+package nextutils
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// * WRITE FILE ATOMIC * //
+// ? Schreibt zuerst in eine temporäre Datei im selben Verzeichnis, synct sie und benennt
+// ? sie dann um. Nach einem Absturz liegt entweder die alte oder die neue Datei vollständig vor.
+
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return err
+	}
+	return SyncDir(dir)
+}
+
+// * APPEND FILE SYNC * //
+// ? Hängt data an eine Datei an und wartet, bis die Daten auf der Platte sind
+
+func AppendFileSync(path string, data []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// * SYNC DIRECTORY * //
+
+func SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	// ? Nicht jedes Dateisystem (z.B. Windows) unterstützt fsync auf Verzeichnissen
+	d.Sync()
+	return nil
+}
+
+// * REMOVE TEMP FILES * //
+// ? Entfernt übrig gebliebene temporäre Dateien von WriteFileAtomic
+
+func RemoveTempFiles(dir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.tmp-*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, match := range matches {
+		if err := os.Remove(match); err != nil {
+			return nil, err
+		}
+	}
+	return matches, nil
+}
@@ -2,9 +2,9 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"math"
 	"net"
 	"net/http"
 	"nxtchain/clitools"
@@ -13,6 +13,7 @@ import (
 	"nxtchain/nextutils"
 	"nxtchain/nxtblock"
 	"nxtchain/nxtutxodb"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -22,13 +23,16 @@ import (
 var version string = "0.0.0"
 var devmode bool = true
 var blockHeightCounts = make(map[int]int)
-var utxodbs = make(map[string]map[string]nxtutxodb.UTXO)
+var utxoHashes = make(map[string]nxtblock.UTXOState)
+var selectedUTXOState nxtblock.UTXOState
+var utxoHashSelected bool
 var totalResponses int
 var totalUDBresponses int
 var blockdir string = "blocks"
+var utxodir string = "utxodb"
+var utxoVerified bool
 var remainingBlockHeights int
 var remainingDBs int
-var timeTargetMin float64 = 10
 
 var port = "0"
 
@@ -40,9 +44,35 @@ var ruleset nxtblock.RuleSet
 func main() {
 	seedNode := flag.String("seednode", "", "Optional seed node IP address")
 	debug := flag.Bool("debug", false, "Enable debug mode")
+	reindex := flag.Bool("reindex", false, "Rebuild the UTXO database from local blocks and exit")
+	verifychain := flag.Bool("verifychain", false, "Validate all local blocks against a rebuilt UTXO set and exit")
+	reindextx := flag.Bool("reindextx", false, "Rebuild the transaction index from local blocks and exit")
+	reindexaddr := flag.Bool("reindexaddr", false, "Rebuild the address index from local blocks and exit")
+	exportFile := flag.String("export", "", "Export the active chain to an archive file and exit")
+	importFile := flag.String("import", "", "Import and validate blocks from an archive file and exit")
 	flag.Parse()
 
 	startup(&devmode, debug)
+	if *reindex || *verifychain {
+		runReindex(*verifychain)
+		return
+	}
+	if *reindextx {
+		if err := nxtblock.RebuildTxIndex(blockdir); err != nil {
+			nextutils.Error("Error rebuilding transaction index: %v", err)
+		}
+		return
+	}
+	if *reindexaddr {
+		if err := nxtblock.RebuildAddrIndex(blockdir); err != nil {
+			nextutils.Error("Error rebuilding address index: %v", err)
+		}
+		return
+	}
+	if *exportFile != "" || *importFile != "" {
+		runArchive(*exportFile, *importFile)
+		return
+	}
 	go startWebserver()
 	createPeer(*seedNode)
 }
@@ -65,7 +95,9 @@ func start(Peer *gonetic.Peer) {
 		if len(Peer.GetConnectedPeers()) > 0 {
 			nextutils.Debug("%s", "Starting syncronization...")
 			nextutils.Debug("%s", "Syncing Blockchain...")
-			syncUTXODB(Peer)
+			if !utxoVerified {
+				syncUTXODB(Peer)
+			}
 			syncBlockchain(Peer)
 			nextutils.Debug("%s", "Syncronization complete.")
 			fmt.Println("+- SYNC COMPLETE -")
@@ -94,6 +126,11 @@ func start(Peer *gonetic.Peer) {
 				connected := Peer.GetConnectedPeers()
 				nextutils.Info("+- CONNECTED PEERS -")
 				for _, conn := range connected {
+					handshake, _ := Peer.GetPeerHandshake(conn)
+					if prunedHeight := nxtblock.ParsePrunedHandshake(handshake); prunedHeight > 0 {
+						nextutils.Info("+- %s (pruned up to height %d)", conn, prunedHeight)
+						continue
+					}
 					nextutils.Info("%s", "+- "+conn)
 				}
 			} else if strings.HasPrefix(input, "$blockheight") {
@@ -108,6 +145,14 @@ func start(Peer *gonetic.Peer) {
 				syncBlockchain(Peer)
 				nextutils.Debug("%s", "Syncronization complete.")
 				nextutils.Info("+- SYNC COMPLETE -")
+			} else if strings.HasPrefix(input, "$invalidatetip") {
+				block, returned, err := nxtblock.InvalidateTip(blockdir, ruleset)
+				if err != nil {
+					nextutils.Error("Error invalidating tip: %v", err)
+					continue
+				}
+				nextutils.Info("+- INVALIDATED BLOCK -")
+				nextutils.Info("+- %s (height %d), %d of %d transactions returned to the pool", block.Hash, block.BlockHeight, returned, len(block.Transactions))
 			} else if strings.HasPrefix(input, "$restart") {
 				start(Peer)
 			}
@@ -117,6 +162,55 @@ func start(Peer *gonetic.Peer) {
 	}
 }
 
+// * REINDEX / VERIFYCHAIN * //
+func runReindex(verifyOnly bool) {
+	var result nxtblock.ReindexResult
+	var matches bool
+	var err error
+	if verifyOnly {
+		nextutils.Info("Verifying local chain in %s...", blockdir)
+		result, matches, err = nxtblock.VerifyChain(blockdir, ruleset)
+	} else {
+		nextutils.Info("Reindexing local chain in %s...", blockdir)
+		result, err = nxtblock.Reindex(blockdir, ruleset)
+	}
+	if err != nil {
+		nextutils.Error("Error reindexing chain: %v", err)
+		return
+	}
+
+	nextutils.Info("+- %d valid blocks, tip %s (height %d)", result.Blocks, result.Tip.Hash, result.Tip.Height)
+	if result.InvalidHash != "" {
+		nextutils.Error("+- First invalid block: %s (height %d): %v", result.InvalidHash, result.InvalidHeight, result.InvalidError)
+	}
+	nextutils.Info("+- UTXO commitment: %s", result.Commitment)
+	if verifyOnly {
+		nextutils.Info("+- Matches local UTXO database: %t", matches)
+	}
+}
+
+// * EXPORT / IMPORT ARCHIVE * //
+func runArchive(exportFile string, importFile string) {
+	if exportFile != "" {
+		nextutils.Info("Exporting local chain in %s to %s...", blockdir, exportFile)
+		header, err := nxtblock.ExportChain(blockdir, exportFile)
+		if err != nil {
+			nextutils.Error("Error exporting chain: %v", err)
+			return
+		}
+		nextutils.Info("+- Exported %d blocks, tip %s (height %d)", header.Blocks, header.TipHash, header.TipHeight)
+		return
+	}
+
+	nextutils.Info("Importing %s into %s...", importFile, blockdir)
+	header, imported, err := nxtblock.ImportChain(blockdir, importFile, ruleset)
+	if err != nil {
+		nextutils.Error("Error importing chain: %v", err)
+	}
+	nextutils.Info("+- %d of %d blocks imported, archive tip %s (height %d)", imported, header.Blocks, header.TipHash, header.TipHeight)
+	nextutils.Info("+- Local chain height: %d", nxtblock.GetLocalBlockHeight(blockdir))
+}
+
 // * HOMEPAGE HTML * //
 func GetHomepageHTML() string {
 	fmt.Printf("Request for homepage\n")
@@ -170,6 +264,8 @@ func syncBlockchain(peer *gonetic.Peer) {
 	// * DIE anderen peers schicken die blöcke zurück privat an dich zurück
 
 	peer.Broadcast("RGET_BLOCKHEIGHT_" + peer.GetConnString())
+	// ? Uhrzeit der Peers für die Netzwerkzeit (Zeitstempel-Regeln der Blöcke)
+	peer.Broadcast("RGET_TIME_" + peer.GetConnString())
 
 }
 func startBlockchainSync(selectedHeight int, peer *gonetic.Peer) {
@@ -205,12 +301,12 @@ func startBlockchainSync(selectedHeight int, peer *gonetic.Peer) {
 		nextutils.Debug("No missing blocks found. No sync needed.")
 	}
 }
-func getMostFrequentBlockHeight() int {
-	var maxHeight, maxCount int
-	for height, count := range blockHeightCounts {
-		if count > maxCount {
+func getBestBlockHeight() int {
+	// ? Bis zur höchsten gemeldeten Höhe laden, welche Kette gilt entscheidet die kumulierte Arbeit
+	var maxHeight int
+	for height := range blockHeightCounts {
+		if height > maxHeight {
 			maxHeight = height
-			maxCount = count
 		}
 	}
 	return maxHeight
@@ -220,91 +316,60 @@ func getMostFrequentBlockHeight() int {
 
 func syncUTXODB(peer *gonetic.Peer) {
 	nextutils.Debug("%s", "Syncing UTXO DB...")
-	// ? Broadcasten und alle UTXO datenbanken hashen, der meiste hash gewinnt und wird dann gesetzt
+	// ? Zuerst nur die Commitment-Hashes abfragen, das komplette Set wird danach nur von
+	// ? einem Peer geladen, dessen Hash und Tip der Mehrheit entsprechen
+	utxoHashes = make(map[string]nxtblock.UTXOState)
+	totalUDBresponses = 0
+	utxoHashSelected = false
 	remainingDBs = len(peer.GetConnectedPeers())
-	peer.Broadcast("RGET_UTXODB_" + peer.GetConnString())
+	peer.Broadcast("RGET_UTXOHASH_" + peer.GetConnString())
 
 }
-func compareMaps(m1, m2 map[string]nxtutxodb.UTXO) bool {
-	if len(m1) != len(m2) {
-		return false
-	}
-	for k, v1 := range m1 {
-		v2, ok := m2[k]
-		if !ok || v1 != v2 {
-			return false
-		}
+func getMostFrequentUTXOHash() (nxtblock.UTXOState, []string) {
+	counts := make(map[nxtblock.UTXOState]int)
+	for _, state := range utxoHashes {
+		counts[state]++
 	}
-	return true
-}
-
-func getMostFrequentUTXODB() map[string]nxtutxodb.UTXO {
-	var maxDB map[string]nxtutxodb.UTXO
+	var maxState nxtblock.UTXOState
 	var maxCount int
-	for _, utxoDB := range utxodbs {
-		count := 0
-		for _, db := range utxodbs {
-			if compareMaps(db, utxoDB) {
-				count++
-			}
-		}
-		if count > maxCount {
-			maxDB = utxoDB
+	for state, count := range counts {
+		if count > maxCount || (count == maxCount && state.Commitment < maxState.Commitment) {
+			maxState = state
 			maxCount = count
 		}
 	}
-	return maxDB
+	var holders []string
+	for conn, state := range utxoHashes {
+		if state == maxState {
+			holders = append(holders, conn)
+		}
+	}
+	sort.Strings(holders)
+	return maxState, holders
 }
 
-// * DIFFICULTY ADJUSTER * //
-
-func adjustDifficulty() {
-	nextutils.Debug("%s", "Adjusting difficulty...")
-	// ? Calculate average time between blocks
-	// ? Compare to target time
-	// ? Adjust difficulty
-
-	lblocks, err := nxtblock.GetLatestBlocks(blockdir, 20)
-	if err != nil {
-		nextutils.Error("Error getting latest blocks: %v", err)
+func selectUTXODB(peer *gonetic.Peer) {
+	if utxoHashSelected {
 		return
 	}
-	blockPtrs := make([]*nxtblock.Block, len(lblocks))
-	for i := range lblocks {
-		blockPtrs[i] = &lblocks[i]
-	}
+	utxoHashSelected = true
 
-	avgTime := nxtblock.CheckBlockTimestampForDifficulty(blockPtrs)
-	if avgTime == 0 {
-		nextutils.Error("%s", "Not enough blocks to calculate difficulty")
+	state, holders := getMostFrequentUTXOHash()
+	if len(holders) == 0 {
 		return
 	}
-
-	nextutils.Debug("Average time between blocks: %f", avgTime)
-	nextutils.Debug("Target time: %f", timeTargetMin)
-	avgTime = math.Round(avgTime)
-	valid := avgTime < timeTargetMin || avgTime > timeTargetMin
-	nextutils.Debug("Need to change difficulty? %t", valid)
-	direction := "increase"
-	if avgTime > timeTargetMin+1 {
-		direction = "decrease"
-		ruleset.Difficulty--
-		configmanager.SetItem("ruleset", ruleset, &config, true)
-	} else if math.Abs(avgTime-timeTargetMin) <= 1 {
-		direction = "do nothing"
-	}
-	if direction == "increase" {
-		ruleset.Difficulty++
-		configmanager.SetItem("ruleset", ruleset, &config, true)
-	}
-	configmanager.SaveConfig(config)
-	nextutils.Debug("Difficulty should %s", direction)
-	nextutils.Debug("New difficulty: %d", ruleset.Difficulty)
-	time.Sleep(5 * time.Minute)
+	nextutils.Debug("Selected UTXO commitment for sync: %s at %s (height %d) (%d/%d peers)", state.Commitment, state.Tip.Hash, state.Tip.Height, len(holders), len(utxoHashes))
+	if state == nxtblock.GetUTXOState() {
+		nextutils.Debug("%s", "Local UTXO DB already matches the selected commitment.")
+		return
+	}
+	selectedUTXOState = state
+	peer.Broadcast("RGET_UTXODB_" + state.Commitment + "_" + state.Tip.Hash + "_" + holders[0] + "_" + peer.GetConnString())
 }
 
 // * PEER OUTPUT HANDLER * //
-func handleEvents(event string, peer *gonetic.Peer) {
+// ? source ist die Verbindung (gonetic peerID), über die das Event ankam
+func handleEvents(event string, source string, peer *gonetic.Peer) {
 	nextutils.Debug("%s", "[PEER EVENT] "+event)
 
 	// ? INPUT REQUESTS
@@ -330,9 +395,6 @@ func handleEvents(event string, peer *gonetic.Peer) {
 				walletAddr := parts[1]
 				requesterConn := parts[2]
 				nextutils.Debug("%s", "Sending inputs to: "+requesterConn+" for wallet: "+walletAddr)
-				//! TEST
-				nxtutxodb.AddUTXO("1", 0, 100000000000000, "rpiZNDkFnb7f5CnYTnoASqHHUSt1Jpn4dJLSqH4tLSw", 1, false)
-				//! -----
 				inputs := nxtutxodb.GetUTXOByWalletAddr(walletAddr)
 				inputsJson, err := json.Marshal(inputs)
 				if err != nil {
@@ -347,9 +409,6 @@ func handleEvents(event string, peer *gonetic.Peer) {
 				nextutils.Error("%s", "Invalid INPUTS request format")
 			}
 		} else if strings.HasPrefix(event_body, "BALANCE_") {
-			//! TEST
-			nxtutxodb.AddUTXO("1", 0, 100000000000000, "rpiZNDkFnb7f5CnYTnoASqHHUSt1Jpn4dJLSqH4tLSw", 1, false)
-			//! -----
 			parts := strings.Split(event_body, "_")
 			if len(parts) >= 3 {
 				walletAddr := parts[1]
@@ -387,6 +446,98 @@ func handleEvents(event string, peer *gonetic.Peer) {
 				peer.Broadcast("RESPONSE_TRANSACTIONS_" + string(transactionsJson) + "_" + walletAddr)
 
 			}
+		} else if strings.HasPrefix(event_body, "HISTORY_") {
+			// ? HISTORY_<wallet>_<cursor>_<limit>_<requester>, leerer Cursor = erste Seite
+			parts := strings.Split(event_body, "_")
+			if len(parts) >= 5 {
+				walletAddr := parts[1]
+				cursor := parts[2]
+				requesterConn := parts[4]
+				limit, err := strconv.Atoi(parts[3])
+				if err != nil {
+					nextutils.Error("Invalid HISTORY limit: %v", err)
+					return
+				}
+				history, err := nxtblock.GetAddressHistory(blockdir, walletAddr, cursor, limit)
+				if err != nil {
+					nextutils.Error("Error getting history: %v", err)
+					return
+				}
+				historyJson, err := json.Marshal(history)
+				if err != nil {
+					nextutils.Error("Error marshaling history: %v", err)
+					return
+				}
+				peer.Broadcast("RESPONSE_HISTORY_" + string(historyJson) + "_" + walletAddr)
+				nextutils.Debug("%s", "[+] Sent history ("+strconv.Itoa(len(history.Entries))+" entries) to: "+requesterConn+" for wallet: "+walletAddr)
+			} else {
+				nextutils.Error("%s", "Invalid HISTORY request format")
+			}
+		} else if strings.HasPrefix(event_body, "TRANSACTION_") {
+			parts := strings.Split(event_body, "_")
+			if len(parts) >= 3 {
+				txid := parts[1]
+				requesterConn := parts[2]
+				transaction, location, err := nxtblock.GetTransactionByID(blockdir, txid)
+				if err != nil {
+					nextutils.Debug("%s", "Transaction "+txid+" requested by "+requesterConn+" not found: "+err.Error())
+					return
+				}
+				transactionJson, err := json.Marshal(struct {
+					Transaction nxtblock.Transaction
+					Location    nxtblock.TxLocation
+				}{transaction, location})
+				if err != nil {
+					nextutils.Error("Error marshaling transaction: %v", err)
+					return
+				}
+				peer.Broadcast("RESPONSE_TRANSACTION_" + string(transactionJson) + "_" + txid)
+				nextutils.Debug("%s", "[+] Sent transaction "+txid+" to: "+requesterConn)
+			}
+		} else if strings.HasPrefix(event_body, "UTXOHASH_") {
+			parts := strings.Split(event_body, "_")
+			if len(parts) >= 2 {
+				requester := parts[1]
+				state := nxtblock.GetUTXOState()
+				peer.Broadcast("RESPONSE_UTXOHASH_" + state.Commitment + "_" + state.Tip.Hash + "_" + strconv.Itoa(state.Tip.Height) + "_" + peer.GetConnString())
+				nextutils.Debug("%s", "[+] Sent UTXO commitment to: "+requester+" ("+state.Commitment+")")
+			}
+		} else if strings.HasPrefix(event_body, "UTXODB_") {
+			parts := strings.Split(event_body, "_")
+			if len(parts) >= 5 {
+				hash := parts[1]
+				tipHash := parts[2]
+				target := parts[3]
+				requester := parts[4]
+				if target != peer.GetConnString() {
+					return
+				}
+				state, utxoDB := nxtblock.CopyUTXOState()
+				if hash != state.Commitment || tipHash != state.Tip.Hash {
+					nextutils.Debug("%s", "UTXO DB requested by "+requester+" does not match local commitment, not sending")
+					return
+				}
+				utxoDBStr, err := nxtblock.PrepareUTXOSender(utxoDB)
+				if err != nil {
+					nextutils.Error("Error: %v", err)
+					return
+				}
+				peer.Broadcast("RESPONSE_UTXODB_" + utxoDBStr)
+				nextutils.Debug("%s", "[+] Sent UTXO DB to: "+requester)
+			}
+		} else if strings.HasPrefix(event_body, "TIME_") {
+			requester := strings.TrimPrefix(event_body, "TIME_")
+			peer.Broadcast("RESPONSE_TIME_" + strconv.FormatInt(nxtblock.GetTimestamp(), 10) + "_" + peer.GetConnString())
+			nextutils.Debug("%s", "[+] Sent time to: "+requester)
+		} else if strings.HasPrefix(event_body, "BLOCKHEIGHT_") {
+			parts := strings.Split(event_body, "_")
+			requester := ""
+			if len(parts) > 1 {
+				requester = parts[1]
+			}
+			blockHeight := nxtblock.GetLocalBlockHeight(blockdir)
+			peer.Broadcast("RESPONSE_BLOCKHEIGHT_" + strconv.Itoa(blockHeight))
+			nextutils.Debug("%s", "[+] Sent block height to: "+requester+" ("+strconv.Itoa(blockHeight)+")")
 		} else if strings.HasPrefix(event_body, "BLOCK_") {
 			parts := strings.Split(event_body, "_")
 			if len(parts) >= 2 {
@@ -400,13 +551,18 @@ func handleEvents(event string, peer *gonetic.Peer) {
 					nextutils.Error("Error: %v", err)
 					return
 				}
-				blockJson, err := json.Marshal(block)
+				if nxtblock.IsBlockPruned(blockdir, block.Hash) {
+					nextutils.Debug("%s", "Block (height: "+parts[1]+") is pruned, refusing request: "+event_body)
+					peer.Broadcast("RESPONSE_BLOCKPRUNED_" + parts[1] + "_" + peer.GetConnString())
+					return
+				}
+				blockStr, err := nxtblock.PrepareBlockSender(block)
 				if err != nil {
 					nextutils.Error("Error: %v", err)
 					return
 				}
 				nextutils.Debug("%s", "Sending block (height: "+parts[1]+") to: "+event_body)
-				peer.Broadcast("RESPONSE_BLOCK_" + string(blockJson))
+				peer.Broadcast("RESPONSE_BLOCK_" + blockStr)
 			}
 		}
 	case "NEW": // * NEW - NEUE OBJEKTE * //
@@ -427,7 +583,7 @@ func handleEvents(event string, peer *gonetic.Peer) {
 
 			// * VALIDATE TRANSACTION * //
 			nextutils.Debug("%s", "Validating transaction (ID: "+newTransaction.ID+")...")
-			valid, err := nxtblock.ValidatorValidateTransaction(newTransaction)
+			valid, err := nxtblock.ValidatorValidateTransaction(newTransaction, ruleset)
 			if err != nil {
 				nextutils.Error("%s", "Error: Transaction (ID: "+newTransaction.ID+") is not valid")
 				nextutils.Error("Error: %v", err)
@@ -440,6 +596,11 @@ func handleEvents(event string, peer *gonetic.Peer) {
 				return
 			}
 			nextutils.Debug("%s", "Transaction (ID: "+newTransaction.ID+") is valid.")
+			if err := nxtblock.CheckRelayFee(newTransaction, nxtblock.MinRelayFeeRate); err != nil {
+				nextutils.Error("%s", "Error: Transaction (ID: "+newTransaction.ID+") rejected")
+				nextutils.Error("Error: %v", err)
+				return
+			}
 		case "BLOCK":
 			newBlock, err := nxtblock.GetBlockSender(newObject)
 			if err != nil {
@@ -448,35 +609,18 @@ func handleEvents(event string, peer *gonetic.Peer) {
 			}
 
 			nextutils.Debug("%s", "Validating block (ID: "+newBlock.Id+")...")
-			valid, err := nxtblock.ValidatorValidateBlock(newBlock, blockdir, ruleset)
-			if err != nil {
+			if err := nxtblock.AcceptBlock(newBlock, blockdir, ruleset); err != nil {
+				if errors.Is(err, nxtblock.ErrOrphanBlock) {
+					nextutils.Debug("%s", "Block (ID: "+newBlock.Id+") kept as orphan until its previous block arrives.")
+					return
+				}
 				nextutils.Error("%s", "Error: Block (ID: "+newBlock.Id+") is not valid")
 				nextutils.Error("Error: %v", err)
 				return
 			}
-			if !valid {
-				nextutils.Error("%s", "Error: Block (ID: "+newBlock.Id+") is not valid")
-				return
-			}
 			nextutils.Debug("%s", "Block (ID: "+newBlock.Id+") is valid.")
 			nextutils.Info("%s", "Block (ID: "+newBlock.Id+") is valid.")
-			nextutils.Debug("Saving block...")
-			path := nxtblock.SaveBlock(newBlock, blockdir)
-			nextutils.Debug("%s", "Block saved: "+path)
-			nextutils.Debug("Updating UTXO database...")
-			nxtblock.DeleteBlockUTXOs(newBlock.Transactions)
-			nxtblock.ConvertBlockToUTXO(newBlock)
-			allblocks, err := nxtblock.GetAllBlocks(blockdir)
-			if err != nil {
-				nextutils.Error("Error getting all blocks: %v", err)
-				return
-			}
-			if len(allblocks)%10 == 0 {
-				adjustDifficulty()
-			} else {
-				nextutils.Debug("%s", "No need to adjust difficulty")
-			}
-			nextutils.Debug("UTXO database updated.")
+			nextutils.Debug("Block saved and UTXO database updated.")
 		default:
 			nextutils.Debug("%s", "Unknown new object: "+newObject)
 		}
@@ -497,38 +641,20 @@ func handleEvents(event string, peer *gonetic.Peer) {
 			}
 
 			nextutils.Debug("%s", "Validating block (ID: "+newBlock.Id+")...")
-			valid, err := nxtblock.ValidatorValidateBlock(newBlock, blockdir, ruleset)
-			if err != nil {
+			if err := nxtblock.AcceptBlock(newBlock, blockdir, ruleset); err != nil {
+				if errors.Is(err, nxtblock.ErrOrphanBlock) {
+					nextutils.Debug("%s", "Block (ID: "+newBlock.Id+") kept as orphan until its previous block arrives.")
+					return
+				}
 				nextutils.Error("%s", "Error: Block (ID: "+newBlock.Id+") is not valid.") //FIX: One block is not v alid form them
 				nextutils.Error("Error: %v", err)
 				return
 			}
-			if !valid {
-				nextutils.Error("%s", "Error: Block (ID: "+newBlock.Id+") is not valid")
-				return
-			}
-			nextutils.Debug("%s", "Block (ID: "+newBlock.Id+") is valid. Saving block...")
-			path := nxtblock.SaveBlock(newBlock, blockdir)
-			nextutils.Debug("%s", "Block saved: "+path)
-			nextutils.Debug("Updating UTXO database...")
-			nxtblock.DeleteBlockUTXOs(newBlock.Transactions)
-			nxtblock.ConvertBlockToUTXO(newBlock)
-			allblocks, err := nxtblock.GetAllBlocks(blockdir)
-			if err != nil {
-				nextutils.Error("Error getting all blocks: %v", err)
-				return
-			}
-			if len(allblocks)%10 == 0 {
-				adjustDifficulty()
-			} else {
-				nextutils.Debug("%s", "No need to adjust difficulty")
-			}
-			nextutils.Debug("UTXO database updated.")
+			nextutils.Debug("%s", "Block (ID: "+newBlock.Id+") is valid.")
+			nextutils.Debug("Block saved and UTXO database updated.")
 
 		case "BLOCKHEIGHT":
-			heightStr := strings.TrimPrefix(respObject, "BLOCKHEIGHT_")
-			heightStr = strings.TrimSpace(heightStr)
-			blockHeight, err := strconv.Atoi(heightStr)
+			blockHeight, err := strconv.Atoi(strings.TrimSpace(respObject))
 			if err != nil {
 				nextutils.Error("Error converting block height: %v", err)
 				return
@@ -548,7 +674,7 @@ func handleEvents(event string, peer *gonetic.Peer) {
 					time.Sleep(5 * time.Second)
 					if totalResponses < remainingBlockHeights {
 						nextutils.Debug("Timeout reached, proceeding with available responses")
-						selectedHeight := getMostFrequentBlockHeight()
+						selectedHeight := getBestBlockHeight()
 						nextutils.Debug("Selected block height for sync: %d", selectedHeight)
 						startBlockchainSync(selectedHeight, peer)
 					}
@@ -556,41 +682,81 @@ func handleEvents(event string, peer *gonetic.Peer) {
 			}
 
 			if totalResponses >= remainingBlockHeights {
-				selectedHeight := getMostFrequentBlockHeight()
+				selectedHeight := getBestBlockHeight()
 				nextutils.Debug("Selected block height for sync: %d", selectedHeight)
 				startBlockchainSync(selectedHeight, peer)
 			}
 
-		case "UTXODB":
-			utxoDBStr := strings.TrimPrefix(respObject, "UTXODB_")
-			utxoDB, err := nxtblock.GetUTXOSender(utxoDBStr)
+		case "TIME":
+			parts := strings.Split(respObject, "_")
+			if len(parts) < 2 {
+				nextutils.Error("%s", "Invalid TIME response: "+respObject)
+				return
+			}
+			peerTime, err := strconv.ParseInt(parts[0], 10, 64)
 			if err != nil {
-				nextutils.Error("Error: %v", err)
+				nextutils.Error("Error converting peer time: %v", err)
+				return
+			}
+			nxtblock.AddTimeSample(source, peerTime)
+			nextutils.Debug("Time from %s via %s: %d (network time offset: %ds)", parts[1], source, peerTime, nxtblock.GetTimeOffset())
+
+		case "BLOCKPRUNED":
+			parts := strings.Split(respObject, "_")
+			if len(parts) < 2 {
+				nextutils.Error("%s", "Invalid BLOCKPRUNED response: "+respObject)
 				return
 			}
+			nextutils.Debug("%s", "Peer "+parts[1]+" has pruned block at height "+parts[0]+", waiting for a full node to send it")
 
-			utxodbs[peer.GetConnString()] = utxoDB
+		case "UTXOHASH":
+			parts := strings.Split(respObject, "_")
+			if len(parts) < 4 {
+				nextutils.Error("%s", "Invalid UTXOHASH response: "+respObject)
+				return
+			}
+			height, err := strconv.Atoi(parts[2])
+			if err != nil {
+				nextutils.Error("%s", "Invalid UTXOHASH response: "+respObject)
+				return
+			}
+			state := nxtblock.UTXOState{Commitment: parts[0], Tip: nxtutxodb.BlockRef{Hash: parts[1], Height: height}}
+			responder := parts[3]
+
+			utxoHashes[responder] = state
 			totalUDBresponses++
 
-			nextutils.Debug("UTXO DB response from: %s (%d/%d responses)", peer.GetConnString(), totalUDBresponses, remainingDBs)
+			nextutils.Debug("UTXO commitment from: %s (%d/%d responses)", responder, totalUDBresponses, remainingDBs)
 
 			if totalUDBresponses == 1 {
 				go func() {
 					time.Sleep(5 * time.Second)
 					if totalUDBresponses < remainingDBs {
-						nextutils.Debug("Timeout reached, proceeding with available UTXO DB responses")
-						selectedDB := getMostFrequentUTXODB()
-						nextutils.Debug("Selected UTXO DB for sync: %v", selectedDB)
-						nxtutxodb.SetUTXODatabase(selectedDB)
+						nextutils.Debug("Timeout reached, proceeding with available UTXO commitments")
+						selectUTXODB(peer)
 					}
 				}()
 			}
 
 			if totalUDBresponses >= remainingDBs {
-				selectedDB := getMostFrequentUTXODB()
-				nextutils.Debug("Selected UTXO DB for sync: %v", selectedDB)
-				nxtutxodb.SetUTXODatabase(selectedDB)
+				selectUTXODB(peer)
+			}
+
+		case "UTXODB":
+			if selectedUTXOState.Commitment == "" {
+				return
 			}
+			utxoDB, err := nxtblock.GetUTXOSender(respObject)
+			if err != nil {
+				nextutils.Error("Error: %v", err)
+				return
+			}
+			if err := nxtblock.SetPeerUTXODatabase(blockdir, utxoDB, selectedUTXOState); err != nil {
+				nextutils.Error("Received UTXO DB not applied: %v", err)
+				return
+			}
+			selectedUTXOState = nxtblock.UTXOState{}
+			nextutils.Debug("UTXO DB synced (%d entries)", len(utxoDB))
 		}
 
 	default:
@@ -611,8 +777,8 @@ func createPeer(seedNode string) {
 	}
 
 	var peer *gonetic.Peer
-	peerOutput := func(event string) {
-		go handleEvents(event, peer)
+	peerOutput := func(source string, event string) {
+		go handleEvents(event, source, peer)
 	}
 
 	defaultPortStr := config.Fields["default_port"].(string)
@@ -639,11 +805,16 @@ func createPeer(seedNode string) {
 	if default_port != 0 {
 		port = strconv.Itoa(default_port)
 	}
-	peer, err = gonetic.NewPeer(peerOutput, maxConnections, port)
+	peer, err = gonetic.NewPeer(nil, maxConnections, port)
 	if err != nil {
 		nextutils.Error("Error creating peer: %v", err)
 		return
 	}
+	peer.PeerOutput = peerOutput
+	peer.Disconnected = nxtblock.RemoveTimeSample
+	peer.Handshake = func() string {
+		return nxtblock.PrunedHandshake(blockdir)
+	}
 	nextutils.Debug("%s", "Peer created. Starting peer...")
 	nextutils.Debug("%s", "Max connections: "+strconv.Itoa(maxConnections))
 	port = peer.Port
@@ -691,12 +862,35 @@ func startup(debug *bool, withFile *bool) {
 		nextutils.Error("Error setting block_dir: %v", err)
 		return
 	}
-	if err := configmanager.SetItem("ruleset", nxtblock.RuleSet{
-		Difficulty:      6,
-		MaxTransactions: 10,
-		Version:         0,
-		InitialReward:   5000000000000,
-	}, &config, true); err != nil {
+	if err := configmanager.SetItem("block_store", nxtblock.BlockStoreJSON, &config, true); err != nil {
+		nextutils.Error("Error setting block_store: %v", err)
+		return
+	}
+	if err := configmanager.SetItem("utxo_dir", "utxodb", &config, true); err != nil {
+		nextutils.Error("Error setting utxo_dir: %v", err)
+		return
+	}
+	if err := configmanager.SetItem("utxo_snapshot_interval", float64(100), &config, true); err != nil {
+		nextutils.Error("Error setting utxo_snapshot_interval: %v", err)
+		return
+	}
+	if err := configmanager.SetItem("min_relay_fee_rate", float64(nxtblock.DefaultMinRelayFeeRate), &config, true); err != nil {
+		nextutils.Error("Error setting min_relay_fee_rate: %v", err)
+		return
+	}
+	if err := configmanager.SetItem("txindex", false, &config, true); err != nil {
+		nextutils.Error("Error setting txindex: %v", err)
+		return
+	}
+	if err := configmanager.SetItem("addrindex", false, &config, true); err != nil {
+		nextutils.Error("Error setting addrindex: %v", err)
+		return
+	}
+	if err := configmanager.SetItem("prune_depth", float64(0), &config, true); err != nil {
+		nextutils.Error("Error setting prune_depth: %v", err)
+		return
+	}
+	if err := configmanager.SetItem("ruleset", nxtblock.DefaultRuleSet(), &config, true); err != nil {
 		nextutils.Error("Error setting ruleset: %v", err)
 		return
 	}
@@ -723,13 +917,66 @@ func startup(debug *bool, withFile *bool) {
 	if config.Fields["block_dir"] != nil {
 		blockdir = config.Fields["block_dir"].(string)
 	}
+	if config.Fields["block_store"] != nil {
+		if _, err := nxtblock.OpenBlockStore(blockdir, config.Fields["block_store"].(string)); err != nil {
+			nextutils.Error("Error opening block store: %v", err)
+			return
+		}
+	}
+	if config.Fields["utxo_dir"] != nil {
+		utxodir = config.Fields["utxo_dir"].(string)
+	}
+	if config.Fields["utxo_snapshot_interval"] != nil {
+		nxtutxodb.SnapshotInterval = int(config.Fields["utxo_snapshot_interval"].(float64))
+	}
+	if rate, ok := config.Fields["min_relay_fee_rate"].(float64); ok && rate >= 0 {
+		nxtblock.MinRelayFeeRate = nxtblock.Amount(rate)
+	}
+	if err := nxtutxodb.Open(utxodir); err != nil {
+		nextutils.Error("Error opening UTXO database: %v", err)
+		return
+	}
+	repaired, err := nxtblock.RecoverBlockStore(blockdir)
+	if err != nil {
+		nextutils.Error("Error recovering block store: %v", err)
+		return
+	}
+	for _, hash := range repaired {
+		nextutils.Info("Repaired half-applied block %s", hash)
+	}
+	if err := nxtblock.VerifyUTXODatabase(blockdir); err != nil {
+		nextutils.Info("Local UTXO database not verified, syncing from peers: %v", err)
+	} else {
+		utxoVerified = true
+		nextutils.Info("Local UTXO database verified at height %d", nxtutxodb.Tip().Height)
+	}
+	if txindex, ok := config.Fields["txindex"].(bool); ok && txindex {
+		if err := nxtblock.EnableTxIndex(blockdir); err != nil {
+			nextutils.Error("Error enabling transaction index: %v", err)
+		}
+	}
+	if addrindex, ok := config.Fields["addrindex"].(bool); ok && addrindex {
+		if err := nxtblock.EnableAddrIndex(blockdir); err != nil {
+			nextutils.Error("Error enabling address index: %v", err)
+		}
+	}
+	if depth, ok := config.Fields["prune_depth"].(float64); ok && depth > 0 {
+		nxtblock.PruneDepth = int(depth)
+		if nxtblock.PruneDepth < nxtblock.MinPruneDepth {
+			nextutils.Error("prune_depth %d is too small, using %d", nxtblock.PruneDepth, nxtblock.MinPruneDepth)
+			nxtblock.PruneDepth = nxtblock.MinPruneDepth
+		}
+		if pruned, err := nxtblock.PruneBlocks(blockdir); err != nil {
+			nextutils.Error("Error pruning blocks: %v", err)
+		} else {
+			nextutils.Info("Pruned mode: keeping the last %d blocks (%d blocks pruned now, pruned up to height %d)", nxtblock.PruneDepth, pruned, nxtblock.GetPrunedHeight(blockdir))
+		}
+	}
 
-	rulesetMap := config.Fields["ruleset"].(map[string]any)
-	ruleset = nxtblock.RuleSet{
-		Difficulty:      int(rulesetMap["Difficulty"].(float64)),
-		MaxTransactions: int(rulesetMap["MaxTransactions"].(float64)),
-		Version:         int(rulesetMap["Version"].(float64)),
-		InitialReward:   int64(rulesetMap["InitialReward"].(float64)),
+	ruleset, err = nxtblock.ParseRuleSet(config.Fields["ruleset"])
+	if err != nil {
+		nextutils.Error("Error reading ruleset: %v", err)
+		return
 	}
 
 	nextutils.PrintLogo("V "+version+" - (c) 2025 NXTCHAIN. All rights reserved.\n-> NODE APPLICATION", devmode)
@@ -0,0 +1,360 @@
+package nxtblock
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"nxtchain/nextutils"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// * ADDRESS INDEX * //
+// ? Optionaler Index Adresse -> Transaktionen unter <block_dir>/index/addr.idx. Pro Adresse und
+// ? Transaktion gibt es einen Eintrag, der angibt ob die Transaktion die Adresse finanziert (Output)
+// ? oder ihre UTXOs ausgibt (Input, Adresse aus dem Public Key abgeleitet). Die Einträge liegen in
+// ? Reihenfolge der aktiven Kette, also aufsteigend nach Höhe.
+
+const addrIndexFile = "addr.idx"
+
+var MaxHistoryPageSize = 100
+
+type AddressTxRef struct {
+	Txid      string `json:"txid"`
+	BlockHash string `json:"block"`
+	Height    int    `json:"height"`
+	Funding   bool   `json:"funding,omitempty"`
+	Spending  bool   `json:"spending,omitempty"`
+}
+
+type AddressHistory struct {
+	Address    string         `json:"address"`
+	Entries    []AddressTxRef `json:"entries"`
+	NextCursor string         `json:"next_cursor,omitempty"` // leer = keine weiteren Einträge
+}
+
+type addrIndexEntry struct {
+	Op      string `json:"op"`
+	Address string `json:"addr"`
+	AddressTxRef
+}
+
+type addrIndex struct {
+	path      string
+	mutex     sync.RWMutex
+	byAddress map[string][]AddressTxRef
+}
+
+var addrIndexes = make(map[string]*addrIndex)
+var addrIndexesMutex sync.Mutex
+
+func addrIndexPath(dir string) string {
+	return filepath.Join(dir, blockIndexDir, addrIndexFile)
+}
+
+func getAddrIndex(dir string) *addrIndex {
+	addrIndexesMutex.Lock()
+	defer addrIndexesMutex.Unlock()
+	return addrIndexes[filepath.Clean(dir)]
+}
+
+// * ENABLE ADDRESS INDEX * //
+// ? Lädt den Index für ein block_dir. Fehlt er, ist er beschädigt oder passt er nicht zum Tip
+// ? (Absturz zwischen Block und Index), wird er aus der aktiven Kette neu aufgebaut.
+
+func EnableAddrIndex(dir string) error {
+	if getAddrIndex(dir) != nil {
+		return nil
+	}
+
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return err
+	}
+
+	index := &addrIndex{path: addrIndexPath(dir), byAddress: make(map[string][]AddressTxRef)}
+	loaded, err := index.load()
+	if err != nil {
+		nextutils.Error("Error loading address index: %v", err)
+	}
+	if !loaded || !index.matchesTip(store) {
+		nextutils.Info("Building address index for %s...", dir)
+		return RebuildAddrIndex(dir)
+	}
+
+	addrIndexesMutex.Lock()
+	addrIndexes[filepath.Clean(dir)] = index
+	addrIndexesMutex.Unlock()
+	nextutils.Debug("Address index loaded (%d addresses)", len(index.byAddress))
+	return nil
+}
+
+// * REBUILD ADDRESS INDEX * //
+// ? Baut den Index aus allen Blöcken der aktiven Kette neu auf und aktiviert ihn. Auf einem
+// ? Pruned Node fehlen alte Blöcke, dann wird ErrHistoryPruned zurückgegeben.
+
+func RebuildAddrIndex(dir string) error {
+	acceptMutex.Lock()
+	defer acceptMutex.Unlock()
+
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return err
+	}
+	if err := checkFullHistory(store); err != nil {
+		return err
+	}
+
+	index := &addrIndex{path: addrIndexPath(dir), byAddress: make(map[string][]AddressTxRef)}
+	var data []byte
+	err = store.Iterate(func(block Block) error {
+		for _, entry := range blockAddrIndexEntries(block, "put") {
+			line, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			data = append(data, line...)
+			data = append(data, '\n')
+			index.apply(entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error reading blocks: %v", err)
+	}
+	if err := nextutils.WriteFileAtomic(index.path, data, 0644); err != nil {
+		return fmt.Errorf("error writing address index: %v", err)
+	}
+
+	addrIndexesMutex.Lock()
+	addrIndexes[filepath.Clean(dir)] = index
+	addrIndexesMutex.Unlock()
+	nextutils.Info("Address index built (%d addresses)", len(index.byAddress))
+	return nil
+}
+
+// * GET ADDRESS HISTORY * //
+// ? Gibt bis zu limit Transaktionen der Adresse aufsteigend nach Höhe zurück, beginnend nach
+// ? cursor (leer = von vorne). NextCursor der Antwort wird für die nächste Seite übergeben.
+
+func GetAddressHistory(dir string, address string, cursor string, limit int) (AddressHistory, error) {
+	if limit <= 0 || limit > MaxHistoryPageSize {
+		limit = MaxHistoryPageSize
+	}
+
+	var refs []AddressTxRef
+	if index := getAddrIndex(dir); index != nil {
+		index.mutex.RLock()
+		refs = append(refs, index.byAddress[address]...)
+		index.mutex.RUnlock()
+	} else {
+		// ? Ohne Index: aktive Kette durchsuchen
+		store, err := GetBlockStore(dir)
+		if err != nil {
+			return AddressHistory{}, err
+		}
+		err = store.Iterate(func(block Block) error {
+			for _, entry := range blockAddrIndexEntries(block, "put") {
+				if entry.Address == address {
+					refs = append(refs, entry.AddressTxRef)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return AddressHistory{}, fmt.Errorf("error reading blocks: %v", err)
+		}
+	}
+
+	start := 0
+	if cursor != "" {
+		cursorHeight, cursorTxid, err := parseHistoryCursor(cursor)
+		if err != nil {
+			return AddressHistory{}, err
+		}
+		// ? Position nach dem Cursor. Wurde der Eintrag durch einen Reorg entfernt, geht es mit
+		// ? der nächsten Höhe weiter.
+		start = len(refs)
+		for i, ref := range refs {
+			if ref.Height == cursorHeight && ref.Txid == cursorTxid {
+				start = i + 1
+				break
+			}
+			if ref.Height > cursorHeight {
+				start = i
+				break
+			}
+		}
+	}
+
+	history := AddressHistory{Address: address, Entries: []AddressTxRef{}}
+	end := start + limit
+	if end > len(refs) {
+		end = len(refs)
+	}
+	if start < end {
+		history.Entries = refs[start:end]
+	}
+	if end < len(refs) && end > 0 {
+		last := refs[end-1]
+		history.NextCursor = fmt.Sprintf("%d:%s", last.Height, last.Txid)
+	}
+	return history, nil
+}
+
+func parseHistoryCursor(cursor string) (int, string, error) {
+	parts := strings.SplitN(cursor, ":", 2)
+	if len(parts) != 2 {
+		return 0, "", fmt.Errorf("invalid history cursor: %s", cursor)
+	}
+	height, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid history cursor: %s", cursor)
+	}
+	return height, parts[1], nil
+}
+
+// * UPDATE INDEX * //
+// ? Wird nach dem Übernehmen bzw. Trennen eines Blocks aufgerufen. Schlägt das Schreiben fehl,
+// ? wird der Index verworfen und beim nächsten Start neu aufgebaut.
+
+func indexBlockAddresses(dir string, block Block) {
+	updateAddrIndex(dir, blockAddrIndexEntries(block, "put"))
+}
+
+func unindexBlockAddresses(dir string, block Block) {
+	updateAddrIndex(dir, blockAddrIndexEntries(block, "delete"))
+}
+
+func updateAddrIndex(dir string, entries []addrIndexEntry) {
+	index := getAddrIndex(dir)
+	if index == nil || len(entries) == 0 {
+		return
+	}
+
+	var data []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			nextutils.Error("Error encoding address index entry: %v", err)
+			return
+		}
+		data = append(data, line...)
+		data = append(data, '\n')
+	}
+	if err := nextutils.AppendFileSync(index.path, data, 0644); err != nil {
+		nextutils.Error("Error writing address index, disabling it until the next start: %v", err)
+		addrIndexesMutex.Lock()
+		delete(addrIndexes, filepath.Clean(dir))
+		addrIndexesMutex.Unlock()
+		if err := os.Remove(index.path); err != nil && !os.IsNotExist(err) {
+			nextutils.Error("Error removing address index: %v", err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		index.apply(entry)
+	}
+}
+
+// ? Ein Eintrag pro (Adresse, Transaktion) in Reihenfolge des Blocks
+func blockAddrIndexEntries(block Block, op string) []addrIndexEntry {
+	var entries []addrIndexEntry
+	transactions := append(append([]Transaction{}, block.HeadTransactions...), block.Transactions...)
+	for _, transaction := range transactions {
+		positions := make(map[string]int)
+		mark := func(address string, funding bool) {
+			i, exists := positions[address]
+			if !exists {
+				i = len(entries)
+				positions[address] = i
+				entries = append(entries, addrIndexEntry{Op: op, Address: address, AddressTxRef: AddressTxRef{Txid: transaction.ID, BlockHash: block.Hash, Height: block.BlockHeight}})
+			}
+			if funding {
+				entries[i].Funding = true
+			} else {
+				entries[i].Spending = true
+			}
+		}
+		for _, input := range transaction.Inputs {
+			mark(GenerateWalletAddress(input.PublicKey), false)
+		}
+		for _, output := range transaction.Outputs {
+			mark(output.ReceiverAddr, true)
+		}
+	}
+	return entries
+}
+
+// * LOAD INDEX * //
+
+func (i *addrIndex) load() (bool, error) {
+	file, err := os.Open(i.path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry addrIndexEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return false, fmt.Errorf("corrupt address index entry: %v", err)
+		}
+		i.apply(entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (i *addrIndex) apply(entry addrIndexEntry) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	refs := i.byAddress[entry.Address]
+	switch entry.Op {
+	case "put":
+		i.byAddress[entry.Address] = append(refs, entry.AddressTxRef)
+	case "delete":
+		// ? Getrennt wird immer der Tip, die Einträge liegen also am Ende
+		for j := len(refs) - 1; j >= 0; j-- {
+			if refs[j].BlockHash == entry.BlockHash && refs[j].Txid == entry.Txid {
+				refs = append(refs[:j], refs[j+1:]...)
+				break
+			}
+		}
+		if len(refs) == 0 {
+			delete(i.byAddress, entry.Address)
+		} else {
+			i.byAddress[entry.Address] = refs
+		}
+	}
+}
+
+// ? Enthält der Index die Transaktionen des Tips und nichts oberhalb davon?
+func (i *addrIndex) matchesTip(store BlockStore) bool {
+	tip, err := store.Tip()
+	if err != nil {
+		return len(i.byAddress) == 0
+	}
+	for _, refs := range i.byAddress {
+		if len(refs) > 0 && refs[len(refs)-1].Height > tip.BlockHeight {
+			return false
+		}
+	}
+	for _, entry := range blockAddrIndexEntries(tip, "put") {
+		refs := i.byAddress[entry.Address]
+		if len(refs) == 0 || refs[len(refs)-1].BlockHash != tip.Hash {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,154 @@
+package nxtblock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// * AMOUNT * //
+// ? Betrag in Basiseinheiten (1 NXT = NXTDivisor Einheiten, AmountDecimals Nachkommastellen).
+// ? Umrechnung von und nach NXT nur über exakte Dezimalstrings (ParseAmount, String), nie über
+// ? float64. Rechnen mit Add, Sub, Mul und MulDiv meldet Überläufe als Fehler. In JSON steht ein
+// ? Amount als Dezimalstring in NXT ("1.5"), Zahlen werden beim Lesen ebenso als NXT gelesen.
+// ? Transaktionen und UTXOs speichern weiterhin int64 Basiseinheiten.
+
+type Amount int64
+
+const AmountDecimals = 11
+const NXTDivisor int64 = 100000000000 // 10^AmountDecimals
+
+const MaxAmount = Amount(math.MaxInt64)
+
+var ErrAmountOverflow = errors.New("amount overflow")
+
+// * PARSE AMOUNT * //
+// ? "12", "12.5", "-0.00000000001", ".5" (höchstens AmountDecimals Nachkommastellen)
+
+func ParseAmount(value string) (Amount, error) {
+	text := strings.TrimSpace(value)
+	negative := false
+	if strings.HasPrefix(text, "-") || strings.HasPrefix(text, "+") {
+		negative = text[0] == '-'
+		text = text[1:]
+	}
+	whole, fraction, hasPoint := strings.Cut(text, ".")
+	if whole == "" && fraction == "" || hasPoint && fraction == "" {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	if len(fraction) > AmountDecimals {
+		return 0, fmt.Errorf("invalid amount %q: more than %d decimals", value, AmountDecimals)
+	}
+	for _, part := range []string{whole, fraction} {
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return 0, fmt.Errorf("invalid amount %q", value)
+			}
+		}
+	}
+
+	units := new(big.Int)
+	if whole != "" {
+		units.SetString(whole, 10)
+	}
+	units.Mul(units, big.NewInt(NXTDivisor))
+	if fraction != "" {
+		fraction += strings.Repeat("0", AmountDecimals-len(fraction))
+		fractionUnits, _ := new(big.Int).SetString(fraction, 10)
+		units.Add(units, fractionUnits)
+	}
+	if negative {
+		units.Neg(units)
+	}
+	if !units.IsInt64() {
+		return 0, fmt.Errorf("invalid amount %q: %w", value, ErrAmountOverflow)
+	}
+	return Amount(units.Int64()), nil
+}
+
+// * FORMAT AMOUNT * //
+// ? Exakt in NXT, ohne überflüssige Nullen ("12.5", "0.00000000001", "3")
+
+func (a Amount) String() string {
+	units := new(big.Int).SetInt64(int64(a))
+	sign := ""
+	if units.Sign() < 0 {
+		sign = "-"
+		units.Neg(units)
+	}
+	whole, fraction := new(big.Int).QuoRem(units, big.NewInt(NXTDivisor), new(big.Int))
+	if fraction.Sign() == 0 {
+		return sign + whole.String()
+	}
+	decimals := fmt.Sprintf("%0*s", AmountDecimals, fraction.String())
+	return sign + whole.String() + "." + strings.TrimRight(decimals, "0")
+}
+
+// * AMOUNT ARITHMETIC * //
+
+func (a Amount) Add(b Amount) (Amount, error) {
+	if (b > 0 && a > MaxAmount-b) || (b < 0 && a < math.MinInt64-b) {
+		return 0, ErrAmountOverflow
+	}
+	return a + b, nil
+}
+
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if (b < 0 && a > MaxAmount+b) || (b > 0 && a < math.MinInt64+b) {
+		return 0, ErrAmountOverflow
+	}
+	return a - b, nil
+}
+
+func (a Amount) Mul(n int64) (Amount, error) {
+	return a.MulDiv(n, 1)
+}
+
+// ? a * mul / div ohne Zwischenüberlauf (z.B. Prozentsätze), rundet Richtung 0
+func (a Amount) MulDiv(mul int64, div int64) (Amount, error) {
+	if div == 0 {
+		return 0, errors.New("amount division by zero")
+	}
+	result := new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(mul))
+	result.Quo(result, big.NewInt(div))
+	if !result.IsInt64() {
+		return 0, ErrAmountOverflow
+	}
+	return Amount(result.Int64()), nil
+}
+
+// * SUM AMOUNTS * //
+
+func SumAmounts(amounts ...Amount) (Amount, error) {
+	var total Amount
+	for _, amount := range amounts {
+		var err error
+		if total, err = total.Add(amount); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// * AMOUNT JSON * //
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+	amount, err := ParseAmount(text)
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
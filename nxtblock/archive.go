@@ -0,0 +1,231 @@
+package nxtblock
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"nxtchain/nextutils"
+	"os"
+	"path/filepath"
+)
+
+// * CHAIN ARCHIVE * //
+// ? Die aktive Kette als einzelne Datei, um neue Nodes von der Platte zu bootstrappen und
+// ? Testketten weiterzugeben. Aufbau: [Magic][Header][Blöcke aufsteigend nach Höhe][Trailer].
+// ? Header, Blöcke und Trailer sind Records im Format der Segmentdateien ([4 Byte Länge]
+// ? [4 Byte CRC32][Daten]). Header und Trailer sind JSON, Blöcke binär kodiert. Der Trailer
+// ? enthält den SHA-256 über alle Block-Records.
+
+const archiveMagic = "NXTARCH\n"
+const ArchiveVersion = 1
+
+type ArchiveHeader struct {
+	Version   int    `json:"version"`
+	Blocks    int    `json:"blocks"`
+	TipHash   string `json:"tip_hash"`
+	TipHeight int    `json:"tip_height"`
+	ChainWork string `json:"chain_work"` // hex
+	Created   int64  `json:"created"`
+}
+
+type archiveTrailer struct {
+	Blocks   int    `json:"blocks"`
+	Checksum string `json:"checksum"`
+}
+
+// * EXPORT CHAIN * //
+// ? Schreibt die aktive Kette (GENESIS bis Tip) nach path. Gepruned darf kein Block sein.
+
+func ExportChain(dir string, path string) (ArchiveHeader, error) {
+	acceptMutex.Lock()
+	defer acceptMutex.Unlock()
+
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return ArchiveHeader{}, err
+	}
+	hashes, missing := mainChain(store)
+	if len(hashes) == 0 {
+		return ArchiveHeader{}, fmt.Errorf("no local blocks to export")
+	}
+	if missing != "" {
+		return ArchiveHeader{}, fmt.Errorf("block %s of the active chain is missing locally", missing)
+	}
+	for _, hash := range hashes {
+		if store.Pruned(hash) {
+			return ArchiveHeader{}, fmt.Errorf("block %s is pruned, exporting needs all blocks", hash)
+		}
+	}
+
+	tip, err := store.Get(hashes[len(hashes)-1])
+	if err != nil {
+		return ArchiveHeader{}, err
+	}
+	header := ArchiveHeader{Version: ArchiveVersion, Blocks: len(hashes), TipHash: tip.Hash, TipHeight: tip.BlockHeight, Created: GetTimestamp()}
+	if work, exists := store.ChainWork(tip.Hash); exists {
+		header.ChainWork = work.Text(16)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return header, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	writeRecord := func(payload []byte) error {
+		_, err := tmp.Write(encodeSegmentRecord(payload))
+		return err
+	}
+	writeJSONRecord := func(value any) error {
+		payload, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		return writeRecord(payload)
+	}
+
+	if _, err := tmp.WriteString(archiveMagic); err != nil {
+		return header, err
+	}
+	if err := writeJSONRecord(header); err != nil {
+		return header, fmt.Errorf("error writing archive header: %v", err)
+	}
+	checksum := sha256.New()
+	for _, hash := range hashes {
+		block, err := store.Get(hash)
+		if err != nil {
+			return header, fmt.Errorf("error loading block %s: %v", hash, err)
+		}
+		payload := EncodeBlock(block)
+		if err := writeRecord(payload); err != nil {
+			return header, fmt.Errorf("error writing block %s: %v", hash, err)
+		}
+		checksum.Write(payload)
+	}
+	if err := writeJSONRecord(archiveTrailer{Blocks: len(hashes), Checksum: fmt.Sprintf("%x", checksum.Sum(nil))}); err != nil {
+		return header, fmt.Errorf("error writing archive trailer: %v", err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return header, err
+	}
+	if err := tmp.Close(); err != nil {
+		return header, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return header, err
+	}
+	return header, nextutils.SyncDir(filepath.Dir(path))
+}
+
+// * VERIFY ARCHIVE * //
+// ? Prüft Format, Prüfsummen und die Verkettung der Blöcke, ohne etwas zu übernehmen
+
+func VerifyArchive(path string) (ArchiveHeader, error) {
+	return readArchive(path, nil)
+}
+
+// * IMPORT CHAIN * //
+// ? Prüft das Archiv vollständig und übernimmt dann jeden Block mit voller Validierung über
+// ? AcceptBlock. Bereits vorhandene Blöcke werden übersprungen. Gibt die Anzahl neuer Blöcke zurück.
+
+func ImportChain(dir string, path string, ruleset RuleSet) (ArchiveHeader, int, error) {
+	header, err := VerifyArchive(path)
+	if err != nil {
+		return header, 0, err
+	}
+
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return header, 0, err
+	}
+
+	imported := 0
+	_, err = readArchive(path, func(block Block) error {
+		if store.Has(block.Hash) {
+			return nil
+		}
+		if err := AcceptBlock(block, dir, ruleset); err != nil {
+			return fmt.Errorf("block %s (height %d) rejected: %v", block.Hash, block.BlockHeight, err)
+		}
+		imported++
+		return nil
+	})
+	return header, imported, err
+}
+
+func readArchive(path string, fn func(block Block) error) (ArchiveHeader, error) {
+	var header ArchiveHeader
+
+	file, err := os.Open(path)
+	if err != nil {
+		return header, err
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(archiveMagic))
+	if _, err := io.ReadFull(file, magic); err != nil || string(magic) != archiveMagic {
+		return header, fmt.Errorf("%s is not a chain archive", path)
+	}
+	offset := int64(len(archiveMagic))
+
+	readRecord := func() ([]byte, error) {
+		payload, err := readSegmentRecord(file, offset)
+		if err != nil {
+			return nil, err
+		}
+		offset += segmentHeaderSize + int64(len(payload))
+		return payload, nil
+	}
+	readJSONRecord := func(value any) error {
+		payload, err := readRecord()
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(payload, value)
+	}
+
+	if err := readJSONRecord(&header); err != nil {
+		return header, fmt.Errorf("invalid archive header: %v", err)
+	}
+	if header.Version != ArchiveVersion {
+		return header, fmt.Errorf("unsupported archive version %d", header.Version)
+	}
+
+	checksum := sha256.New()
+	previous := Block{Hash: "GENESIS"}
+	for i := 0; i < header.Blocks; i++ {
+		payload, err := readRecord()
+		if err != nil {
+			return header, fmt.Errorf("invalid block record %d: %v", i, err)
+		}
+		checksum.Write(payload)
+		block, err := decodeStoredBlock(payload)
+		if err != nil {
+			return header, fmt.Errorf("invalid block record %d: %v", i, err)
+		}
+		if block.PreviousHash != previous.Hash || block.BlockHeight != previous.BlockHeight+1 {
+			return header, fmt.Errorf("block %s (height %d) does not follow %s (height %d)", block.Hash, block.BlockHeight, previous.Hash, previous.BlockHeight)
+		}
+		if fn != nil {
+			if err := fn(block); err != nil {
+				return header, err
+			}
+		}
+		previous = block
+	}
+	if previous.Hash != header.TipHash {
+		return header, fmt.Errorf("archive ends at %s, header says %s", previous.Hash, header.TipHash)
+	}
+
+	var trailer archiveTrailer
+	if err := readJSONRecord(&trailer); err != nil {
+		return header, fmt.Errorf("invalid archive trailer: %v", err)
+	}
+	if trailer.Blocks != header.Blocks || trailer.Checksum != fmt.Sprintf("%x", checksum.Sum(nil)) {
+		return header, fmt.Errorf("archive checksum mismatch")
+	}
+	return header, nil
+}
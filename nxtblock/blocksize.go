@@ -0,0 +1,100 @@
+package nxtblock
+
+import (
+	"fmt"
+	"nxtchain/nextutils"
+	"sort"
+)
+
+// * BLOCK SIZE * //
+// ? Die Größe eines Blocks zählt nur Daten, die der Blockhash absichert: den Header
+// ? (BlockHeaderSize) und die Binärkodierung aller Transaktionen (über die Merkle Root gebunden).
+// ? Id, Hash, Data, Currency und das Ruleset des Blocks zählen nicht, ein Weiterleiter könnte sie
+// ? sonst auffüllen und einen gültigen Block über MaxBlockSize bringen. Die Grenze kommt immer
+// ? aus dem eigenen Ruleset (Konsensregel, zusätzlich zu MaxTransactions).
+
+const DefaultMaxBlockSize = 1 << 20 // Bytes
+
+func BlockSize(block Block) int {
+	var e nextutils.Encoder
+	writeTransactions(&e, block.Transactions)
+	writeTransactions(&e, block.HeadTransactions)
+	return BlockHeaderSize + len(e.Bytes())
+}
+
+func checkBlockSize(block Block, maxBlockSize int) error {
+	if size := BlockSize(block); size > maxBlockSize {
+		return fmt.Errorf("block too large: %d > %d bytes", size, maxBlockSize)
+	}
+	return nil
+}
+
+// * SELECT BLOCK TRANSACTIONS * //
+// ? Auswahl für den nächsten Block aus dem Mempool: höchste Gebührenrate zuerst, solange
+// ? MaxTransactions und MaxBlockSize eingehalten werden. Transaktionen ohne (verfügbare) UTXOs
+// ? und solche, die einen schon gewählten Input ausgeben, werden übersprungen.
+
+func SelectBlockTransactions(pool []Transaction, ruleset RuleSet, minerAddr string, lastblock Block) []Transaction {
+	type candidate struct {
+		transaction Transaction
+		size        int
+		fee         Amount
+	}
+	candidates := make([]candidate, 0, len(pool))
+	for _, transaction := range pool {
+		fee, err := CalculateTransactionFee(transaction)
+		if err != nil {
+			continue
+		}
+		// ? Ohne Versionsbyte, so steht die Transaktion im Block
+		candidates = append(candidates, candidate{transaction, TransactionSize(transaction) - 1, fee})
+	}
+	// ? fee_i / size_i > fee_j / size_j, als Kreuzprodukt ohne Rundung
+	sort.Slice(candidates, func(i, j int) bool {
+		rateI, errI := candidates[i].fee.Mul(int64(candidates[j].size))
+		rateJ, errJ := candidates[j].fee.Mul(int64(candidates[i].size))
+		if errI == nil && errJ == nil && rateI != rateJ {
+			return rateI > rateJ
+		}
+		return candidates[i].transaction.Hash < candidates[j].transaction.Hash
+	})
+
+	// ? Leerer Block mit größtmöglicher Head-Transaktion als Grundgröße, dazu Platz für eine
+	// ? längere Transaktionsanzahl (Uvarint)
+	template := Block{
+		HeadTransactions: []Transaction{CreateTransactionHeader(minerAddr, MaxAmount, lastblock.BlockHeight+1)},
+	}
+	size := BlockSize(template) + 9
+
+	var selected []Transaction
+	used := make(map[string]bool)
+	for _, c := range candidates {
+		if len(selected) >= ruleset.MaxTransactions {
+			break
+		}
+		if size+c.size > ruleset.MaxBlockSize {
+			continue
+		}
+		// ? Inputs beim Prüfen markieren, damit auch ein innerhalb der Transaktion wiederholter
+		// ? Outpoint auffällt. Erst bei Erfolg in used übernehmen.
+		conflict := false
+		inputs := make(map[string]bool, len(c.transaction.Inputs))
+		for _, input := range c.transaction.Inputs {
+			key := fmt.Sprintf("%s:%d", input.Txid, input.Index)
+			if used[key] || inputs[key] {
+				conflict = true
+				break
+			}
+			inputs[key] = true
+		}
+		if conflict {
+			continue
+		}
+		for key := range inputs {
+			used[key] = true
+		}
+		selected = append(selected, c.transaction)
+		size += c.size
+	}
+	return selected
+}
@@ -0,0 +1,377 @@
+package nxtblock
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"nxtchain/nextutils"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// * BLOCK STORE * //
+// ? Schnittstelle für die Block-Persistenz. Jeder Store führt einen persistenten Index
+// ? (height -> hash, hash -> ort) unter <block_dir>/index/blocks.idx, damit Lookups nach
+// ? Höhe, Hash und Tip nicht jedes Mal das ganze Verzeichnis lesen müssen.
+// ? Gespeichert werden alle Blöcke (inkl. Seitenzweige), GetByHeight, Tip, Height, Count
+// ? und Iterate beziehen sich auf die aktive Kette. Von geprunten Blöcken ist nur noch der
+// ? Header (Block ohne Transaktionen) vorhanden.
+
+type BlockStore interface {
+	Put(block Block) (string, error)
+	Get(hash string) (Block, error)
+	GetByHeight(height int) (Block, error)
+	Has(hash string) bool
+	Delete(hash string) error
+	Prune(hash string) error
+	Pruned(hash string) bool
+	Tip() (Block, error)
+	SetTip(hash string) error
+	ChainWork(hash string) (*big.Int, bool)
+	Height() int
+	Count() int
+	Iterate(fn func(block Block) error) error
+	Rebuild() error
+}
+
+const BlockStoreJSON = "json"
+const BlockStoreSegment = "segment"
+
+const blockIndexDir = "index"
+const blockIndexFile = "blocks.idx"
+
+var blockStores = make(map[string]BlockStore)
+var blockStoresMutex sync.Mutex
+
+// * OPEN BLOCK STORE * //
+// ? Öffnet den Store für ein block_dir mit dem gewünschten Backend (json oder segment)
+
+func OpenBlockStore(dir string, backend string) (BlockStore, error) {
+	key := filepath.Clean(dir)
+
+	blockStoresMutex.Lock()
+	defer blockStoresMutex.Unlock()
+
+	if store, exists := blockStores[key]; exists {
+		if storeBackend(store) != backend {
+			return nil, fmt.Errorf("block store %s is already open as %s", key, storeBackend(store))
+		}
+		return store, nil
+	}
+
+	store, err := openBlockStore(key, backend)
+	if err != nil {
+		return nil, err
+	}
+	blockStores[key] = store
+	return store, nil
+}
+
+// * GET BLOCK STORE * //
+// ? Gibt den (pro Prozess geteilten) Store für ein block_dir zurück. Wurde er noch nicht
+// ? geöffnet, wird das Backend anhand der vorhandenen Dateien erkannt.
+
+func GetBlockStore(dir string) (BlockStore, error) {
+	key := filepath.Clean(dir)
+
+	blockStoresMutex.Lock()
+	defer blockStoresMutex.Unlock()
+
+	if store, exists := blockStores[key]; exists {
+		return store, nil
+	}
+
+	store, err := openBlockStore(key, DetectBlockStore(key))
+	if err != nil {
+		return nil, err
+	}
+	blockStores[key] = store
+	return store, nil
+}
+
+// * DETECT BLOCK STORE * //
+
+func DetectBlockStore(dir string) string {
+	segments, err := segmentFiles(dir)
+	if err == nil && len(segments) > 0 {
+		return BlockStoreSegment
+	}
+	return BlockStoreJSON
+}
+
+func openBlockStore(dir string, backend string) (BlockStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, blockIndexDir), 0755); err != nil {
+		return nil, fmt.Errorf("error creating block index directory: %v", err)
+	}
+
+	switch backend {
+	case BlockStoreJSON, "":
+		if segments, _ := segmentFiles(dir); len(segments) > 0 {
+			return nil, fmt.Errorf("block_dir %s contains segment files, cannot open as %s store", dir, BlockStoreJSON)
+		}
+		return openJSONBlockStore(dir)
+	case BlockStoreSegment:
+		if files, _ := blockFiles(dir); len(files) > 0 {
+			return nil, fmt.Errorf("block_dir %s contains json blocks, cannot open as %s store", dir, BlockStoreSegment)
+		}
+		return openSegmentBlockStore(dir)
+	default:
+		return nil, fmt.Errorf("unknown block store backend: %s", backend)
+	}
+}
+
+func storeBackend(store BlockStore) string {
+	switch store.(type) {
+	case *segmentBlockStore:
+		return BlockStoreSegment
+	default:
+		return BlockStoreJSON
+	}
+}
+
+// * BLOCK INDEX * //
+// ? Gemeinsamer Index beider Backends. File ist für den json-Store gesetzt,
+// ? Segment/Offset/Length für den Segment-Store. Prev und Work (Arbeit des Blocks, hex)
+// ? bilden den Blockbaum, "tip" Einträge setzen die aktive Kette neu (Reorg). "prune" Einträge
+// ? markieren einen Block als gepruned (beim Segment-Store mit dem Ort des Headers).
+
+type blockIndexEntry struct {
+	Op      string `json:"op"`
+	Hash    string `json:"hash"`
+	Height  int    `json:"height,omitempty"`
+	Prev    string `json:"prev,omitempty"`
+	Work    string `json:"work,omitempty"`
+	File    string `json:"file,omitempty"`
+	Segment int    `json:"segment,omitempty"`
+	Offset  int64  `json:"offset,omitempty"`
+	Length  int    `json:"length,omitempty"`
+	Pruned  bool   `json:"pruned,omitempty"`
+}
+
+type blockIndex struct {
+	path      string
+	byHeight  map[int]string             // aktive Kette
+	byHash    map[string]blockIndexEntry // alle Blöcke inkl. Seitenzweige
+	chainWork map[string]*big.Int        // kumulierte Arbeit bis einschließlich Block
+	segments  map[int]int                // Segment-Store: Anzahl Blöcke pro Segment
+	tip       string
+}
+
+func newBlockIndex(dir string) *blockIndex {
+	index := &blockIndex{path: filepath.Join(dir, blockIndexDir, blockIndexFile)}
+	index.reset()
+	return index
+}
+
+func newIndexEntry(block Block) blockIndexEntry {
+	return blockIndexEntry{Op: "put", Hash: block.Hash, Height: block.BlockHeight, Prev: block.PreviousHash, Work: BlockWork(block).Text(16), Pruned: isBlockHeader(block)}
+}
+
+func (i *blockIndex) reset() {
+	i.byHeight = make(map[int]string)
+	i.byHash = make(map[string]blockIndexEntry)
+	i.chainWork = make(map[string]*big.Int)
+	i.segments = make(map[int]int)
+	i.tip = ""
+}
+
+// * LOAD INDEX * //
+
+func (i *blockIndex) load() (bool, error) {
+	file, err := os.Open(i.path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry blockIndexEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return false, fmt.Errorf("corrupt block index entry: %v", err)
+		}
+		if entry.Op == "put" && entry.Work == "" {
+			// ? Index aus einer Version ohne Blockbaum
+			nextutils.Debug("Block index has no chain data, rebuilding...")
+			i.reset()
+			return false, nil
+		}
+		i.apply(entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// * APPLY INDEX ENTRY * //
+
+func (i *blockIndex) apply(entry blockIndexEntry) {
+	switch entry.Op {
+	case "put":
+		work, ok := new(big.Int).SetString(entry.Work, 16)
+		if !ok {
+			work = new(big.Int)
+		}
+		if parentWork, exists := i.chainWork[entry.Prev]; exists {
+			work.Add(work, parentWork)
+		}
+		_, parentKnown := i.byHash[entry.Prev]
+		if old, exists := i.byHash[entry.Hash]; exists {
+			i.segments[old.Segment]--
+		}
+		i.byHash[entry.Hash] = entry
+		i.segments[entry.Segment]++
+		i.chainWork[entry.Hash] = work
+		// ? Blöcke, die den Tip verlängern, werden Teil der aktiven Kette, alle anderen
+		// ? bleiben Seitenzweige bis ein "tip" Eintrag die Kette umstellt
+		if entry.Prev == i.tip || (i.tip == "" && !parentKnown) {
+			i.byHeight[entry.Height] = entry.Hash
+			i.tip = entry.Hash
+		}
+	case "tip":
+		i.setTip(entry.Hash)
+	case "prune":
+		old, exists := i.byHash[entry.Hash]
+		if !exists {
+			return
+		}
+		if entry.Length > 0 {
+			i.segments[old.Segment]--
+			i.segments[entry.Segment]++
+			old.Segment, old.Offset, old.Length = entry.Segment, entry.Offset, entry.Length
+		}
+		old.Pruned = true
+		i.byHash[entry.Hash] = old
+	case "delete":
+		old, exists := i.byHash[entry.Hash]
+		if !exists {
+			return
+		}
+		if i.byHeight[old.Height] == entry.Hash {
+			// ? Block der aktiven Kette: Kette endet danach beim Vorgänger
+			if _, parentKnown := i.byHash[old.Prev]; parentKnown {
+				i.setTip(old.Prev)
+			} else {
+				i.setTip("")
+			}
+		}
+		delete(i.byHash, entry.Hash)
+		delete(i.chainWork, entry.Hash)
+		i.segments[old.Segment]--
+	}
+}
+
+// * SET ACTIVE TIP * //
+// ? Stellt byHeight auf die Kette bis hash um. Nur der Teil ab dem Abzweig wird neu geschrieben.
+
+func (i *blockIndex) setTip(hash string) {
+	newHeight := -1
+	if entry, exists := i.byHash[hash]; exists {
+		newHeight = entry.Height
+	} else {
+		hash = ""
+	}
+	for height := i.height(); height > newHeight; height-- {
+		delete(i.byHeight, height)
+	}
+
+	current, exists := i.byHash[hash]
+	for exists && i.byHeight[current.Height] != current.Hash {
+		i.byHeight[current.Height] = current.Hash
+		current, exists = i.byHash[current.Prev]
+	}
+	i.tip = hash
+}
+
+// * BEST TIP * //
+// ? Block mit der meisten kumulierten Arbeit (bei Gleichstand bleibt der aktuelle Tip)
+
+func (i *blockIndex) bestTip() string {
+	best := i.tip
+	bestWork, exists := i.chainWork[best]
+	if !exists {
+		bestWork = new(big.Int)
+	}
+	for hash, work := range i.chainWork {
+		if work.Cmp(bestWork) > 0 || (work.Cmp(bestWork) == 0 && best == "") {
+			best = hash
+			bestWork = work
+		}
+	}
+	return best
+}
+
+// * APPEND INDEX ENTRY * //
+
+func (i *blockIndex) append(entry blockIndexEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := nextutils.AppendFileSync(i.path, append(line, '\n'), 0644); err != nil {
+		return err
+	}
+	i.apply(entry)
+	return nil
+}
+
+// * REWRITE INDEX * //
+
+func (i *blockIndex) rewrite(entries []blockIndexEntry) error {
+	sort.SliceStable(entries, func(a, b int) bool {
+		return entries[a].Height < entries[b].Height
+	})
+
+	i.reset()
+	for _, entry := range entries {
+		i.apply(entry)
+	}
+	// ? Nach dem Neuaufbau ist die schwerste bekannte Kette aktiv
+	if best := i.bestTip(); best != i.tip {
+		entry := blockIndexEntry{Op: "tip", Hash: best}
+		i.apply(entry)
+		entries = append(entries, entry)
+	}
+
+	var data []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		data = append(data, line...)
+		data = append(data, '\n')
+	}
+	if err := nextutils.WriteFileAtomic(i.path, data, 0644); err != nil {
+		return fmt.Errorf("error writing block index: %v", err)
+	}
+	return nil
+}
+
+func (i *blockIndex) height() int {
+	if entry, exists := i.byHash[i.tip]; exists {
+		return entry.Height
+	}
+	return 0
+}
+
+// * ACTIVE CHAIN ENTRIES (nach Höhe) * //
+
+func (i *blockIndex) sorted() []blockIndexEntry {
+	entries := make([]blockIndexEntry, 0, len(i.byHeight))
+	for _, hash := range i.byHeight {
+		entries = append(entries, i.byHash[hash])
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].Height < entries[b].Height
+	})
+	return entries
+}
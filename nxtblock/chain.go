@@ -0,0 +1,294 @@
+package nxtblock
+
+import (
+	"fmt"
+	"nxtchain/nextutils"
+)
+
+// * BLOCK TREE & CHAIN SELECTION * //
+// ? Der Block Store enthält alle bekannten Blöcke als Baum (PreviousHash), die aktive Kette ist die
+// ? mit der meisten kumulierten Arbeit. Ein Block, der den Tip verlängert, wird direkt übernommen.
+// ? Blöcke auf anderen Zweigen werden nur gespeichert; wird ein Zweig schwerer als die aktive
+// ? Kette, wird umgestellt (Reorg): Blöcke bis zum Abzweig trennen, den neuen Zweig übernehmen.
+
+// * ACCEPT BLOCK * //
+// ? Ist der Vorgänger unbekannt, landet der Block im Orphan Pool und ErrOrphanBlock wird
+// ? zurückgegeben. Nach jedem übernommenen Block werden wartende Orphans erneut versucht.
+
+func AcceptBlock(block Block, dir string, ruleset RuleSet) error {
+	acceptMutex.Lock()
+	defer acceptMutex.Unlock()
+
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return err
+	}
+	if err := acceptBlock(block, dir, ruleset, store); err != nil {
+		return err
+	}
+
+	parents := []string{block.Hash}
+	for len(parents) > 0 {
+		parent := parents[0]
+		parents = parents[1:]
+		for _, orphan := range takeOrphanBlocks(parent) {
+			if err := acceptBlock(orphan, dir, ruleset, store); err != nil {
+				nextutils.Error("Orphan block %s (height %d) rejected: %v", orphan.Hash, orphan.BlockHeight, err)
+				continue
+			}
+			nextutils.Debug("Orphan block %s (height %d) accepted", orphan.Hash, orphan.BlockHeight)
+			parents = append(parents, orphan.Hash)
+		}
+	}
+
+	if _, err := pruneBlocks(dir, store); err != nil {
+		nextutils.Error("Error pruning blocks: %v", err)
+	}
+	return nil
+}
+
+func acceptBlock(block Block, dir string, ruleset RuleSet, store BlockStore) error {
+	if store.Has(block.Hash) {
+		return fmt.Errorf("block %s is already stored", block.Hash)
+	}
+	if err := checkDuplicateTransactions(block); err != nil {
+		return err
+	}
+
+	tip, err := store.Tip()
+	if err != nil {
+		tip = Block{}
+	}
+	if block.PreviousHash == tip.Hash || (tip.Hash == "" && block.PreviousHash == "GENESIS") {
+		return connectBlock(block, dir, ruleset, store, false)
+	}
+
+	if block.PreviousHash != "GENESIS" && !store.Has(block.PreviousHash) {
+		// ? Offensichtlich ungültige Blöcke gar nicht erst aufbewahren
+		if !ValidateBlockHash(block) || !HasProofOfWork(block) {
+			return fmt.Errorf("invalid orphan block %s", block.Hash)
+		}
+		if err := checkOrphanBits(block, tip, ruleset); err != nil {
+			return fmt.Errorf("invalid orphan block %s: %v", block.Hash, err)
+		}
+		addOrphanBlock(block)
+		return fmt.Errorf("%w: block %s (height %d) waits for %s", ErrOrphanBlock, block.Hash, block.BlockHeight, block.PreviousHash)
+	}
+	return acceptSideBlock(block, tip, dir, ruleset, store)
+}
+
+// * CHECK BLOCK HEADER * //
+// ? Prüfungen, die ohne UTXO Set möglich sind (für Blöcke auf Seitenzweigen). Grenzen kommen
+// ? aus dem eigenen Ruleset, nicht aus dem des Blocks.
+
+func CheckBlockHeader(block Block, parent Block, ruleset RuleSet) error {
+	if !ValidateBlockHash(block) {
+		return fmt.Errorf("block hash mismatch for block %s", block.Hash)
+	}
+	if !HasProofOfWork(block) {
+		return fmt.Errorf("block %s does not meet its target %08x", block.Hash, block.Ruleset.Bits)
+	}
+	if block.BlockHeight != parent.BlockHeight+1 {
+		return fmt.Errorf("invalid block height: got %d want %d", block.BlockHeight, parent.BlockHeight+1)
+	}
+	if err := checkBlockFutureTime(block); err != nil {
+		return err
+	}
+	if block.Id != block.Hash {
+		return fmt.Errorf("block ID mismatch: got %s, want %s", block.Id, block.Hash)
+	}
+	if transactionHash := CalculateMerkleRoot(block); block.TransactionHash != transactionHash {
+		return fmt.Errorf("transaction hash mismatch: got %s, want %s", block.TransactionHash, transactionHash)
+	}
+	if err := checkDuplicateTransactions(block); err != nil {
+		return err
+	}
+	if len(block.Transactions) > ruleset.MaxTransactions {
+		return fmt.Errorf("too many transactions in block: %d > %d", len(block.Transactions), ruleset.MaxTransactions)
+	}
+	if err := checkBlockSize(block, ruleset.MaxBlockSize); err != nil {
+		return err
+	}
+	if len(block.HeadTransactions) != 1 {
+		return fmt.Errorf("block %s must have exactly one head transaction, got %d", block.Hash, len(block.HeadTransactions))
+	}
+	return nil
+}
+
+// * ACCEPT SIDE BLOCK * //
+
+func acceptSideBlock(block Block, tip Block, dir string, ruleset RuleSet, store BlockStore) error {
+	parent := Block{}
+	if block.PreviousHash != "GENESIS" {
+		var err error
+		if parent, err = store.Get(block.PreviousHash); err != nil {
+			return err
+		}
+	}
+	if err := CheckBlockHeader(block, parent, ruleset); err != nil {
+		return err
+	}
+	if err := checkBlockMedianTime(store, block, parent); err != nil {
+		return err
+	}
+	if err := checkBlockBits(store, block, parent, ruleset); err != nil {
+		return err
+	}
+	if _, err := store.Put(block); err != nil {
+		return fmt.Errorf("error saving block %s: %v", block.Hash, err)
+	}
+
+	work, _ := store.ChainWork(block.Hash)
+	tipWork, exists := store.ChainWork(tip.Hash)
+	if !exists || work.Cmp(tipWork) <= 0 {
+		nextutils.Debug("Stored block %s (height %d) on a side branch", block.Hash, block.BlockHeight)
+		return nil
+	}
+
+	nextutils.Info("Branch of block %s (height %d) has more work than the active chain, reorganizing...", block.Hash, block.BlockHeight)
+	return reorganize(block, tip, dir, ruleset, store)
+}
+
+// * FIND FORK * //
+// ? Geht vom neuen Tip zurück bis zu einem Block der aktiven Kette. Gibt den Abzweig ("" = vor dem
+// ? ersten Block) und die zu übernehmenden Blöcke aufsteigend zurück.
+
+func findFork(newTip Block, store BlockStore) (string, []Block, error) {
+	var branch []Block
+	block := newTip
+	for {
+		if active, err := store.GetByHeight(block.BlockHeight); err == nil && active.Hash == block.Hash {
+			break
+		}
+		branch = append([]Block{block}, branch...)
+		if block.PreviousHash == "GENESIS" {
+			return "", branch, nil
+		}
+		previous, err := store.Get(block.PreviousHash)
+		if err != nil {
+			return "", nil, fmt.Errorf("block %s of branch not found: %v", block.PreviousHash, err)
+		}
+		block = previous
+	}
+	return block.Hash, branch, nil
+}
+
+// * CHECK DISCONNECT * //
+// ? Vor einem Reorg: jeder Block vom Tip bis (exklusive) fork muss vollständig vorliegen und
+// ? Undo-Daten haben, sonst bliebe die Kette nach dem Trennen halb zurückgesetzt. Im Pruned-Modus
+// ? sind Reorgs tiefer als PruneDepth nicht erlaubt.
+
+func checkDisconnect(fork string, tip Block, dir string, store BlockStore) error {
+	depth := 0
+	block := tip
+	for block.Hash != "" && block.Hash != fork {
+		depth++
+		if PruneDepth > 0 && depth > PruneDepth {
+			return fmt.Errorf("reorg deeper than prune depth %d", PruneDepth)
+		}
+		if isBlockHeader(block) || store.Pruned(block.Hash) {
+			return fmt.Errorf("block %s (height %d) is pruned and cannot be disconnected", block.Hash, block.BlockHeight)
+		}
+		if _, err := LoadBlockUndo(block.Hash, dir); err != nil {
+			return fmt.Errorf("no undo data for block %s (height %d): %v", block.Hash, block.BlockHeight, err)
+		}
+		if block.PreviousHash == "GENESIS" {
+			break
+		}
+		parent, err := store.Get(block.PreviousHash)
+		if err != nil {
+			return fmt.Errorf("block %s not found: %v", block.PreviousHash, err)
+		}
+		block = parent
+	}
+	return nil
+}
+
+// * DISCONNECT TO * //
+// ? Trennt Blöcke vom Tip bis (exklusive) fork und gibt sie absteigend zurück
+
+func disconnectTo(fork string, tip Block, dir string, store BlockStore) ([]Block, error) {
+	var disconnected []Block
+	block := tip
+	for block.Hash != "" && block.Hash != fork {
+		if err := DisconnectBlock(block, dir); err != nil {
+			return disconnected, err
+		}
+		parent := Block{}
+		if block.PreviousHash != "GENESIS" {
+			var err error
+			if parent, err = store.Get(block.PreviousHash); err != nil {
+				return disconnected, err
+			}
+		}
+		if err := store.SetTip(parent.Hash); err != nil {
+			return disconnected, err
+		}
+		disconnected = append(disconnected, block)
+		block = parent
+	}
+	return disconnected, nil
+}
+
+// * REORGANIZE * //
+
+func reorganize(newTip Block, tip Block, dir string, ruleset RuleSet, store BlockStore) error {
+	fork, branch, err := findFork(newTip, store)
+	if err != nil {
+		return err
+	}
+
+	if err := checkDisconnect(fork, tip, dir, store); err != nil {
+		return fmt.Errorf("cannot reorganize to %s: %v", newTip.Hash, err)
+	}
+	for _, block := range branch {
+		if isBlockHeader(block) || store.Pruned(block.Hash) {
+			return fmt.Errorf("cannot reorganize to %s: block %s of branch is pruned", newTip.Hash, block.Hash)
+		}
+	}
+
+	disconnected, err := disconnectTo(fork, tip, dir, store)
+	if err != nil {
+		return fmt.Errorf("error disconnecting block during reorg: %v", err)
+	}
+
+	for i, block := range branch {
+		err := connectBlock(block, dir, ruleset, store, true)
+		if err == nil {
+			continue
+		}
+
+		// ? Ungültiger Block im neuen Zweig: Zweig verwerfen und alte Kette wiederherstellen
+		nextutils.Error("Reorg to %s failed at block %s: %v", newTip.Hash, block.Hash, err)
+		for _, invalid := range branch[i:] {
+			if err := store.Delete(invalid.Hash); err != nil {
+				nextutils.Error("Error removing invalid block %s: %v", invalid.Hash, err)
+			}
+		}
+		current, tipErr := store.Tip()
+		if tipErr != nil {
+			current = Block{}
+		}
+		if _, err := disconnectTo(fork, current, dir, store); err != nil {
+			return fmt.Errorf("error restoring chain after failed reorg: %v", err)
+		}
+		for j := len(disconnected) - 1; j >= 0; j-- {
+			if err := connectBlock(disconnected[j], dir, ruleset, store, true); err != nil {
+				return fmt.Errorf("error restoring chain after failed reorg: %v", err)
+			}
+		}
+		return err
+	}
+
+	// ? Transaktionen des neuen Zweigs aus dem Pool, die der getrennten Blöcke zurück, soweit
+	// ? sie auf dem neuen Tip noch gültig sind
+	for _, block := range branch {
+		for _, transaction := range block.Transactions {
+			RemoveTransactionFromPool(transaction)
+		}
+	}
+	returned := returnTransactionsToPool(disconnected, ruleset)
+
+	nextutils.Info("Reorg complete: %d blocks disconnected, %d connected, new tip %s (height %d), %d transactions returned to the pool", len(disconnected), len(branch), newTip.Hash, newTip.BlockHeight, returned)
+	return nil
+}
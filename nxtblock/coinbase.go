@@ -0,0 +1,70 @@
+package nxtblock
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"nxtchain/nextutils"
+	"nxtchain/nxtutxodb"
+)
+
+// * COINBASE * //
+// ? Jeder Block hat genau eine Head-Transaktion (Coinbase) ohne Inputs und mit genau einem Output
+// ? an den Miner (Belohnung + Gebühren). Ihre ID hängt nur von Blockhöhe und Inhalt ab
+// ? (CalculateCoinbaseID), damit gleiche Belohnungen an dieselbe Adresse in verschiedenen Blöcken
+// ? nicht denselben UTXO Key erzeugen. Coinbase UTXOs sind erst RuleSet.CoinbaseMaturity Blöcke
+// ? später ausgebbar.
+
+const DefaultCoinbaseMaturity = 100
+
+const coinbaseTag = "NXT-COINBASE-1"
+
+// * CALCULATE COINBASE ID * //
+
+func CalculateCoinbaseID(height int, transaction Transaction) string {
+	var e nextutils.Encoder
+	e.PutString(coinbaseTag)
+	e.PutVarint(int64(height))
+	e.PutString(CalculateSigHash(transaction))
+	return fmt.Sprintf("%x", sha256.Sum256(e.Bytes()))
+}
+
+// * CHECK COINBASE * //
+
+func checkCoinbase(block Block, reward Amount) error {
+	if len(block.HeadTransactions) != 1 {
+		return fmt.Errorf("block must have exactly one head transaction, got %d", len(block.HeadTransactions))
+	}
+	coinbase := block.HeadTransactions[0]
+	if len(coinbase.Inputs) != 0 {
+		return fmt.Errorf("head transaction must not have inputs, got %d", len(coinbase.Inputs))
+	}
+	if len(coinbase.Outputs) != 1 || coinbase.Outputs[0].Index != 0 {
+		return fmt.Errorf("head transaction must have exactly one output with index 0")
+	}
+	if sigHash := CalculateSigHash(coinbase); coinbase.Hash != sigHash {
+		return fmt.Errorf("head transaction hash mismatch: got %s, want %s", coinbase.Hash, sigHash)
+	}
+	if id := CalculateCoinbaseID(block.BlockHeight, coinbase); coinbase.ID != id {
+		return fmt.Errorf("head transaction ID mismatch: got %s, want %s", coinbase.ID, id)
+	}
+	if Amount(coinbase.Outputs[0].Amount) != reward {
+		return fmt.Errorf("invalid block reward: got %s, want %s", Amount(coinbase.Outputs[0].Amount), reward)
+	}
+	return nil
+}
+
+// * CHECK COINBASE MATURITY * //
+// ? height ist die Höhe des Blocks, in dem die Transaktion landet (bzw. landen würde)
+
+func CheckCoinbaseMaturity(transaction Transaction, view *nxtutxodb.View, height int, maturity int) error {
+	for _, input := range transaction.Inputs {
+		utxo, exists := view.Get(input.Txid, input.Index)
+		if !exists || !utxo.IsHeadTransaction {
+			continue
+		}
+		if depth := height - utxo.BlockHeight; depth < maturity {
+			return fmt.Errorf("head transaction output %s:%d is immature: %d of %d blocks", input.Txid, input.Index, depth, maturity)
+		}
+	}
+	return nil
+}
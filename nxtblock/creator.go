@@ -1,7 +1,9 @@
 package nxtblock
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
 	"math"
 	"math/rand"
@@ -12,35 +14,92 @@ import (
 )
 
 type RuleSet struct {
-	Difficulty      int
-	MaxTransactions int
-	Version         int
-	InitialReward   int64
+	Bits             uint32 // Kompaktes Target (work.go), Start-Target für den ersten Block (difficulty.go)
+	MaxTransactions  int
+	Version          int
+	InitialReward    int64
+	CoinbaseMaturity int // Blöcke, bis Head-Transaktion Outputs ausgegeben werden dürfen (coinbase.go)
+	MaxBlockSize     int // Bytes aus Header und Transaktionen (blocksize.go)
 }
 
-// ! Block struct Marked with "+" are the ones in the hash
+// * DEFAULT RULESET * //
+// ? Standardwerte für neue Configs (Node, Miner) und für die DevKit ohne Config
+
+func DefaultRuleSet() RuleSet {
+	return RuleSet{
+		Bits:             DifficultyBits(6),
+		MaxTransactions:  10,
+		Version:          0,
+		InitialReward:    5000000000000,
+		CoinbaseMaturity: DefaultCoinbaseMaturity,
+		MaxBlockSize:     DefaultMaxBlockSize,
+	}
+}
+
+// * PARSE RULESET * //
+// ? Ruleset aus der Config (frisch gesetzt als RuleSet, aus der Datei als map). Ältere Configs
+// ? haben statt Bits die Difficulty als Anzahl führender Hex-Nullen.
+
+func ParseRuleSet(value any) (RuleSet, error) {
+	if ruleset, ok := value.(RuleSet); ok {
+		return ruleset, nil
+	}
+	fields, ok := value.(map[string]any)
+	if !ok {
+		return RuleSet{}, fmt.Errorf("invalid ruleset %v", value)
+	}
+	number := func(key string) float64 {
+		number, _ := fields[key].(float64)
+		return number
+	}
+
+	ruleset := RuleSet{
+		Bits:             uint32(number("Bits")),
+		MaxTransactions:  int(number("MaxTransactions")),
+		Version:          int(number("Version")),
+		InitialReward:    int64(number("InitialReward")),
+		CoinbaseMaturity: int(number("CoinbaseMaturity")),
+		MaxBlockSize:     int(number("MaxBlockSize")),
+	}
+	if _, exists := fields["Bits"]; !exists {
+		ruleset.Bits = DifficultyBits(int(number("Difficulty")))
+	}
+	if _, exists := fields["CoinbaseMaturity"]; !exists {
+		ruleset.CoinbaseMaturity = DefaultCoinbaseMaturity
+	}
+	if _, exists := fields["MaxBlockSize"]; !exists {
+		ruleset.MaxBlockSize = DefaultMaxBlockSize
+	}
+	if _, err := CompactToTarget(ruleset.Bits); err != nil {
+		return ruleset, fmt.Errorf("invalid ruleset: %v", err)
+	}
+	return ruleset, nil
+}
+
+// ! Block struct Marked with "+" are the ones in the hash (BlockHeader, header.go)
 
 type Block struct {
-	Id               string        // ID des Blocks 												+
+	Id               string        // ID des Blocks (gleich dem Hash)
 	Timestamp        int64         // Zeitstempel des Blocks										+
 	PreviousHash     string        // Hash des vorherigen Blocks									+
-	Hash             string        // Hash des Blocks
-	Data             string        // Daten des Blocks												+
-	TransactionHash  string        // Hashes der Transaktionen vereint								+
-	Nonce            int64         // Zufallszahl die den Blockhash erzeugt
-	Transactions     []Transaction // Transaktionen des Blocks										+
-	HeadTransactions []Transaction // Head-Transaktionen des Blocks (Miner-Transaktionen)			+
-	Ruleset          RuleSet       // Regeln des Blocks												+
-	Currency         string        // Währung des Blocks (aus welcher währung basiert der Block)	+
-	BlockHeight      int           // Höhe des Blocks
+	Hash             string        // Hash des Blocks (Hash des Headers)
+	Data             string        // Daten des Blocks
+	TransactionHash  string        // Merkle Root aller Transaktionen inkl. Head-Transaktion		+
+	Nonce            int64         // Zufallszahl die den Blockhash erzeugt							+
+	Transactions     []Transaction // Transaktionen des Blocks (über TransactionHash)				+
+	HeadTransactions []Transaction // Head-Transaktionen des Blocks (über TransactionHash)			+
+	Ruleset          RuleSet       // Regeln des Blocks (Version und Bits)							+
+	Currency         string        // Währung des Blocks (aus welcher währung basiert der Block)
+	BlockHeight      int           // Höhe des Blocks												+
 }
 
 func NewBlock(transactions []Transaction, ruleset RuleSet, minerAddr string, currency string, data string, lastblock Block) (*Block, error) {
 	nextutils.NewLine()
 	nextutils.Debug("Beginning block creation...")
 	nextutils.Debug("- Transactions: %v", transactions)
-	nextutils.Debug("- Difficulty: %v", ruleset.Difficulty)
+	nextutils.Debug("- Bits: %08x", ruleset.Bits)
 	nextutils.Debug("- Max Transactions: %v", ruleset.MaxTransactions)
+	nextutils.Debug("- Max Block Size: %v", ruleset.MaxBlockSize)
 	nextutils.Debug("- Version: %v", ruleset.Version)
 	nextutils.Debug("- Miner Address: %v", minerAddr)
 	nextutils.Debug("- Currency: %v", currency)
@@ -56,36 +115,58 @@ func NewBlock(transactions []Transaction, ruleset RuleSet, minerAddr string, cur
 	// ? 1. Fee berechnen & als Belohnung speichern
 	// ? 2. Transactionhash berechnen & MaxTransactions prüfen
 	// ? 3. HeadTransaction erstellen (aus Belohnung)
-	// ? 4. Blockhash berechnen (Proof of Work mit difficulty aus dem ruleset)
+	// ? 4. Header bilden und Blockhash berechnen (Proof of Work mit dem Target aus dem ruleset)
 
 	// ? 5. Block validieren
 
 	// * 1. FEE BERECHNEN * //
-	blockFee := CalculateBlockFee(transactions)
+	blockFee, err := calculateBlockFee(transactions, nxtutxodb.NewView())
+	if err != nil {
+		return nil, err
+	}
 	nextutils.Debug("Block Fee: %v", blockFee)
 
-	// * 2. TRANSACTIONHASH BERECHNEN * //
-	transactionHash := CalculateTransactionHash(transactions)
-
-	// * 2.1 MAXTRANSACTIONS PRÜFEN * //
+	// * 2. MAXTRANSACTIONS PRÜFEN * //
 	maxTransactions := ruleset.MaxTransactions
 	if len(transactions) > maxTransactions {
 		return nil, fmt.Errorf("too many transactions in block: %d > %d", len(transactions), maxTransactions)
 	}
 
 	// * 3. HEADTRANSACTION ERSTELLEN * //
-	headTransaction := CreateTransactionHeader(minerAddr, int64(blockFee)+CalculateBlockReward(ruleset.InitialReward, int64(lastblock.BlockHeight+1)))
+	reward, err := blockFee.Add(Amount(CalculateBlockReward(ruleset.InitialReward, int64(lastblock.BlockHeight+1))))
+	if err != nil {
+		return nil, fmt.Errorf("block reward: %v", err)
+	}
+	headTransaction := CreateTransactionHeader(minerAddr, reward, lastblock.BlockHeight+1)
 
-	timestamp := time.Now().Unix()
+	// ? Netzwerkzeit, aber immer nach dem letzten Block (sonst verletzt der Block bei schnellen
+	// ? Blöcken die Median Time Past Regel)
+	timestamp := GetAdjustedTime()
+	if timestamp <= lastblock.Timestamp {
+		timestamp = lastblock.Timestamp + 1
+	}
+
+	newBlock := &Block{
+		Timestamp:        timestamp,
+		PreviousHash:     lastblock.Hash,
+		Data:             data,
+		Transactions:     transactions,
+		HeadTransactions: []Transaction{headTransaction},
+		Ruleset:          ruleset,
+		Currency:         currency,
+		BlockHeight:      lastblock.BlockHeight + 1,
+	}
+	newBlock.TransactionHash = CalculateMerkleRoot(*newBlock)
+	if size := BlockSize(*newBlock); size > ruleset.MaxBlockSize {
+		return nil, fmt.Errorf("block too large: %d > %d bytes", size, ruleset.MaxBlockSize)
+	}
 
-	blockID := fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%d%s%v%v%v",
-		timestamp,
-		lastblock.Hash,
-		blockFee,
-		transactionHash,
-		headTransaction.Hash))))
+	// * 4. HEADER BILDEN & BLOCKHASH BERECHNEN * //
+	header, err := GetBlockHeader(*newBlock)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block header: %v", err)
+	}
 
-	// * 4. BLOCKHASH BERECHNEN * //
 	workers := 1
 	var wg sync.WaitGroup
 	hashChannel := make(chan string, workers)
@@ -93,29 +174,15 @@ func NewBlock(transactions []Transaction, ruleset RuleSet, minerAddr string, cur
 	for i := 0; i < workers; i++ {
 		wg.Add(1)
 		strategy := "ascending"
-		go CreateBlockHash(i, workers, blockID, timestamp, lastblock.Hash, data, transactionHash, ruleset, currency, hashChannel, nonceChannel, &wg, strategy)
+		go CreateBlockHash(i, workers, header, ruleset, hashChannel, nonceChannel, &wg, strategy)
 	}
 	wg.Wait()
 	close(hashChannel)
 	close(nonceChannel)
 
-	blockhash := <-hashChannel
-	nonce := <-nonceChannel
-
-	newBlock := &Block{
-		Id:               blockID,
-		Timestamp:        timestamp,
-		PreviousHash:     lastblock.Hash,
-		Hash:             blockhash,
-		Data:             data,
-		TransactionHash:  transactionHash,
-		Nonce:            nonce,
-		Transactions:     transactions,
-		HeadTransactions: []Transaction{headTransaction},
-		Ruleset:          ruleset,
-		Currency:         currency,
-		BlockHeight:      lastblock.BlockHeight + 1,
-	}
+	newBlock.Hash = <-hashChannel
+	newBlock.Nonce = <-nonceChannel
+	newBlock.Id = newBlock.Hash
 
 	return newBlock, nil
 
@@ -135,78 +202,104 @@ func CalculateBlockReward(initialReward int64, n int64) int64 {
 
 // * CALCULATE BLOCK FEE * //
 
-func CalculateTransactionFee(tx Transaction) (int64, error) {
-	var totalInput, totalOutput int64
-	//! TEST
-	nxtutxodb.AddUTXO("1", 0, 100000000000000, "rpiZNDkFnb7f5CnYTnoASqHHUSt1Jpn4dJLSqH4tLSw", 1, false)
-	//! -----
+func CalculateTransactionFee(tx Transaction) (Amount, error) {
+	return calculateTransactionFee(tx, nxtutxodb.NewView())
+}
+
+func calculateTransactionFee(tx Transaction, view *nxtutxodb.View) (Amount, error) {
+	var totalInput, totalOutput Amount
 	for _, in := range tx.Inputs {
-		amount, err := nxtutxodb.GetUTXOAmount(in.Txid, in.Index)
+		amount, err := view.Amount(in.Txid, in.Index)
 		if err != nil {
 			return 0, fmt.Errorf("error retrieving UTXO: %v", err)
 		}
-		totalInput += amount
+		if totalInput, err = totalInput.Add(Amount(amount)); err != nil {
+			return 0, fmt.Errorf("total input: %v", err)
+		}
 	}
 
 	for _, out := range tx.Outputs {
-		totalOutput += out.Amount
+		var err error
+		if totalOutput, err = totalOutput.Add(Amount(out.Amount)); err != nil {
+			return 0, fmt.Errorf("total output: %v", err)
+		}
 	}
 
-	return totalInput - totalOutput, nil
+	return totalInput.Sub(totalOutput)
 }
 
 // * CALCULATE BLOCK FEE * //
+// ? Transaktionen mit fehlenden UTXOs werden übersprungen, ein Überlauf der Summe ist ein Fehler
 
-func CalculateBlockFee(transactions []Transaction) int64 {
-	var totalFee int64
+func CalculateBlockFee(transactions []Transaction) (Amount, error) {
+	return calculateBlockFee(transactions, nxtutxodb.NewView())
+}
+
+func calculateBlockFee(transactions []Transaction, view *nxtutxodb.View) (Amount, error) {
+	var totalFee Amount
 
 	for _, tx := range transactions {
-		fee, err := CalculateTransactionFee(tx)
+		fee, err := calculateTransactionFee(tx, view)
 		if err != nil {
 			nextutils.Debug("Skipping transaction due to error: %v", err)
 			continue
 		}
-		totalFee += fee
+		if totalFee, err = totalFee.Add(fee); err != nil {
+			return 0, fmt.Errorf("block fee: %v", err)
+		}
 	}
 
-	return totalFee
+	return totalFee, nil
 }
 
 // * CALCULATE TRANSACTION HASH * //
+// ? Merkle Root über die Transaktionen. Blatt ist der SHA-256 der Binärkodierung (encoding.go),
+// ? damit jedes Feld jeder Transaktion abgedeckt ist. Knoten hashen die 64 Byte der beiden
+// ? Kinder, bei ungerader Anzahl wird das letzte Element verdoppelt. Blöcke mit doppelten
+// ? Transaktionen sind deshalb ungültig (checkDuplicateTransactions, header.go).
 
 func CalculateTransactionHash(transactions []Transaction) string {
 	if len(transactions) == 0 {
 		return fmt.Sprintf("%x", sha256.Sum256([]byte("")))
 	}
 
-	var leaves []string
+	leaves := make([][32]byte, 0, len(transactions))
 	for _, tx := range transactions {
-		leaves = append(leaves, tx.Hash)
+		leaves = append(leaves, sha256.Sum256(EncodeTransaction(tx)))
 	}
 
 	for len(leaves) > 1 {
 		if len(leaves)%2 == 1 {
 			leaves = append(leaves, leaves[len(leaves)-1])
 		}
-		var temp []string
+		var temp [][32]byte
 		for i := 0; i < len(leaves); i += 2 {
-			combined := leaves[i] + leaves[i+1]
-			hash := fmt.Sprintf("%x", sha256.Sum256([]byte(combined)))
-			temp = append(temp, hash)
+			temp = append(temp, sha256.Sum256(append(leaves[i][:], leaves[i+1][:]...)))
 		}
 		leaves = temp
 	}
 
-	return leaves[0]
+	return fmt.Sprintf("%x", leaves[0])
 }
 
 // * CREATE BLOCK HASH * //
+// ? Sucht eine Nonce, sodass der Hash des Headers höchstens dem Target entspricht. Der Header wird einmal
+// ? serialisiert, pro Versuch werden nur die Bytes der Nonce ersetzt.
 
-func CreateBlockHash(workerID int, workers int, Id string, timestamp int64, previousHash string, data string, transactionHash string, ruleset RuleSet, currency string, hashChannel chan string, nonceChannel chan int64, wg *sync.WaitGroup, strategy string) {
+func CreateBlockHash(workerID int, workers int, header BlockHeader, ruleset RuleSet, hashChannel chan string, nonceChannel chan int64, wg *sync.WaitGroup, strategy string) {
 	defer wg.Done()
 
 	var hash string
 	var nonce int64
+	headerBytes := header.Bytes()
+
+	target, err := CompactToTarget(ruleset.Bits)
+	if err != nil {
+		nextutils.Error("Error: %v", err)
+		return
+	}
+	targetBytes := target.FillBytes(make([]byte, 32))
+
 	maxNonce := int64(math.MaxInt64)
 
 	switch strategy {
@@ -229,23 +322,8 @@ func CreateBlockHash(workerID int, workers int, Id string, timestamp int64, prev
 
 	startTime := time.Now()
 	for {
-		hashStr := fmt.Sprintf("%s%d%s%s%s%d%s",
-			Id,
-			timestamp,
-			previousHash,
-			data,
-			transactionHash,
-			nonce,
-			currency,
-		)
-
-		hashBytes := sha256.Sum256([]byte(hashStr))
-		hash = fmt.Sprintf("%x", hashBytes)
-
-		leadingZeros := 0
-		for i := 0; i < len(hash) && hash[i] == '0'; i++ {
-			leadingZeros++
-		}
+		binary.BigEndian.PutUint64(headerBytes[headerNonceOffset:], uint64(nonce))
+		hashBytes := sha256.Sum256(headerBytes)
 
 		if nonce >= maxNonce {
 			break
@@ -253,11 +331,12 @@ func CreateBlockHash(workerID int, workers int, Id string, timestamp int64, prev
 
 		if nonce%50000 == 0 {
 			elapsed := time.Since(startTime)
-			fmt.Printf("\rWorker [%d]   │   Nonce: %d   │   Hash: %s   │   Time: %8v   │   Target: %2d   │   Current: %2d",
-				workerID, nonce, hash, elapsed.Round(time.Millisecond), ruleset.Difficulty, leadingZeros)
+			fmt.Printf("\rWorker [%d]   │   Nonce: %d   │   Hash: %x   │   Time: %8v   │   Target: %08x",
+				workerID, nonce, hashBytes, elapsed.Round(time.Millisecond), ruleset.Bits)
 		}
 
-		if leadingZeros >= ruleset.Difficulty {
+		if bytes.Compare(hashBytes[:], targetBytes) <= 0 {
+			hash = fmt.Sprintf("%x", hashBytes)
 			hashChannel <- hash
 			nonceChannel <- nonce
 			return
@@ -274,20 +353,12 @@ func CreateBlockHash(workerID int, workers int, Id string, timestamp int64, prev
 }
 
 // * VALIDATE BLOCK HASH * //
+// ? Stimmt der Blockhash mit dem Hash des Headers überein?
 
 func ValidateBlockHash(block Block) bool {
-	hashStr := fmt.Sprintf("%s%d%s%s%s%d%s",
-		block.Id,
-		block.Timestamp,
-		block.PreviousHash,
-		block.Data,
-		block.TransactionHash,
-		block.Nonce,
-		block.Currency,
-	)
-
-	hashBytes := sha256.Sum256([]byte(hashStr))
-	hash := fmt.Sprintf("%x", hashBytes)
-
-	return hash == block.Hash
+	header, err := GetBlockHeader(block)
+	if err != nil {
+		return false
+	}
+	return header.Hash() == block.Hash
 }
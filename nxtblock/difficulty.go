@@ -1,23 +1,106 @@
 package nxtblock
 
 import (
-	"sort"
+	"fmt"
+	"math/big"
 )
 
-func CheckBlockTimestampForDifficulty(blocks []*Block) float64 {
-	if len(blocks) < 2 {
-		return 0
+// * DIFFICULTY RETARGETING * //
+// ? Das Target jedes Blocks ist eine reine Funktion seiner Vorgänger (LWMA, linear gewichteter
+// ? gleitender Durchschnitt): Durchschnitt der Targets der letzten RetargetWindow Blöcke, skaliert
+// ? mit deren gewichteten Blockzeiten (jüngere Blöcke zählen mehr) im Verhältnis zu TargetBlockTime.
+// ? Miner und Validator berechnen es gleich, RuleSet.Bits ist nur noch das Start-Target.
+
+const TargetBlockTime int64 = 600 // Sekunden
+const RetargetWindow = 45
+
+// * NEXT BLOCK BITS * //
+// ? Bits, die ein Block auf parent haben muss (parent.Hash == "" für den ersten Block)
+
+func GetNextBlockBits(dir string, parent Block, ruleset RuleSet) (uint32, error) {
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return 0, err
+	}
+	return nextBlockBits(store, parent, ruleset)
+}
+
+func nextBlockBits(store BlockStore, parent Block, ruleset RuleSet) (uint32, error) {
+	window := RetargetWindow
+	if parent.BlockHeight-1 < window {
+		window = parent.BlockHeight - 1
+	}
+	if parent.Hash == "" || parent.Hash == "GENESIS" || window < 1 {
+		return ruleset.Bits, nil
+	}
+
+	// ? window+1 Blöcke (window Blockzeiten), aufsteigend nach Höhe
+	blocks := make([]Block, window+1)
+	blocks[window] = parent
+	for i := window - 1; i >= 0; i-- {
+		previous, err := store.Get(blocks[i+1].PreviousHash)
+		if err != nil {
+			return 0, fmt.Errorf("block %s needed for retargeting not found: %v", blocks[i+1].PreviousHash, err)
+		}
+		blocks[i] = previous
+	}
+	return calculateNextBits(blocks), nil
+}
+
+// ? LWMA über aufsteigend sortierte Blöcke. Blockzeiten werden auf höchstens 6 * TargetBlockTime
+// ? begrenzt, Zeitstempel davor müssen für die Rechnung streng steigend sein.
+func calculateNextBits(blocks []Block) uint32 {
+	window := int64(len(blocks) - 1)
+
+	sumTargets := new(big.Int)
+	var weightedTimes int64
+	previousTimestamp := blocks[0].Timestamp
+	for i := int64(1); i <= window; i++ {
+		block := blocks[i]
+		timestamp := block.Timestamp
+		if timestamp <= previousTimestamp {
+			timestamp = previousTimestamp + 1
+		}
+		solveTime := timestamp - previousTimestamp
+		if solveTime > 6*TargetBlockTime {
+			solveTime = 6 * TargetBlockTime
+		}
+		previousTimestamp = timestamp
+		weightedTimes += i * solveTime
+
+		target, err := CompactToTarget(block.Ruleset.Bits)
+		if err != nil {
+			target = new(big.Int).Set(PowLimit)
+		}
+		sumTargets.Add(sumTargets, target)
+	}
+
+	// ? Erwartete gewichtete Zeit bei Blöcken genau im Takt: TargetBlockTime * window*(window+1)/2
+	expected := TargetBlockTime * window * (window + 1) / 2
+	if weightedTimes < expected/10 {
+		weightedTimes = expected / 10
 	}
 
-	var totalTimeDiff float64
+	next := sumTargets.Mul(sumTargets, big.NewInt(weightedTimes))
+	next.Div(next, big.NewInt(expected*window))
+	if next.Sign() == 0 {
+		next.SetInt64(1)
+	}
+	if next.Cmp(PowLimit) > 0 {
+		next.Set(PowLimit)
+	}
+	return TargetToCompact(next)
+}
 
-	sort.Slice(blocks, func(i, j int) bool {
-		return blocks[i].Timestamp < blocks[j].Timestamp
-	})
+// * CHECK BLOCK BITS * //
 
-	for i := 1; i < len(blocks); i++ {
-		timeDiff := float64(blocks[i].Timestamp-blocks[i-1].Timestamp) / 60
-		totalTimeDiff += timeDiff
+func checkBlockBits(store BlockStore, block Block, parent Block, ruleset RuleSet) error {
+	bits, err := nextBlockBits(store, parent, ruleset)
+	if err != nil {
+		return err
+	}
+	if block.Ruleset.Bits != bits {
+		return fmt.Errorf("invalid target: got %08x, want %08x", block.Ruleset.Bits, bits)
 	}
-	return totalTimeDiff / float64(len(blocks)-1)
+	return nil
 }
@@ -0,0 +1,209 @@
+package nxtblock
+
+import (
+	"encoding/json"
+	"fmt"
+	"nxtchain/nextutils"
+)
+
+// * BINARY ENCODING * //
+// ? Versionierte, kanonische Binärkodierung für Blöcke und Transaktionen (Segment-Store, Archive,
+// ? Netzwerk). Signaturen und Public Keys werden roh statt base64 gespeichert. JSON bleibt für
+// ? APIs, den json Block-Store und zum Debuggen erhalten.
+// ?
+// ? Block:       Version, Id, Timestamp, PreviousHash, Hash, Data, TransactionHash, Nonce,
+// ?              Transactions, HeadTransactions, Ruleset, Currency, BlockHeight
+// ? RuleSet:     Bits, MaxTransactions, Version, InitialReward, CoinbaseMaturity, MaxBlockSize
+// ? Transaction: ID, Timestamp, Hash, Inputs, Outputs
+// ? TInput:      Txid, Index, Signature, PublicKey
+// ? TOutput:     Index, Amount, ReceiverAddr
+// ? Listen sind Anzahl + Elemente, nur Block und Transaktion tragen (eigenständig) die Version.
+
+func writeTInput(e *nextutils.Encoder, input TInput) {
+	e.PutString(input.Txid)
+	e.PutVarint(int64(input.Index))
+	e.PutBytes(input.Signature)
+	e.PutBytes(input.PublicKey)
+}
+
+func readTInput(d *nextutils.Decoder) TInput {
+	return TInput{
+		Txid:      d.String(),
+		Index:     int(d.Varint()),
+		Signature: d.Bytes(),
+		PublicKey: d.Bytes(),
+	}
+}
+
+func writeTOutput(e *nextutils.Encoder, output TOutput) {
+	e.PutVarint(int64(output.Index))
+	e.PutVarint(output.Amount)
+	e.PutString(output.ReceiverAddr)
+}
+
+func readTOutput(d *nextutils.Decoder) TOutput {
+	return TOutput{
+		Index:        int(d.Varint()),
+		Amount:       d.Varint(),
+		ReceiverAddr: d.String(),
+	}
+}
+
+func writeTransaction(e *nextutils.Encoder, transaction Transaction) {
+	e.PutString(transaction.ID)
+	e.PutVarint(transaction.Timestamp)
+	e.PutString(transaction.Hash)
+	e.PutUvarint(uint64(len(transaction.Inputs)))
+	for _, input := range transaction.Inputs {
+		writeTInput(e, input)
+	}
+	e.PutUvarint(uint64(len(transaction.Outputs)))
+	for _, output := range transaction.Outputs {
+		writeTOutput(e, output)
+	}
+}
+
+func readTransaction(d *nextutils.Decoder) Transaction {
+	transaction := Transaction{
+		ID:        d.String(),
+		Timestamp: d.Varint(),
+		Hash:      d.String(),
+	}
+	if count := d.Count(); count > 0 {
+		transaction.Inputs = make([]TInput, 0, count)
+		for i := 0; i < count && d.Err() == nil; i++ {
+			transaction.Inputs = append(transaction.Inputs, readTInput(d))
+		}
+	}
+	if count := d.Count(); count > 0 {
+		transaction.Outputs = make([]TOutput, 0, count)
+		for i := 0; i < count && d.Err() == nil; i++ {
+			transaction.Outputs = append(transaction.Outputs, readTOutput(d))
+		}
+	}
+	return transaction
+}
+
+func writeTransactions(e *nextutils.Encoder, transactions []Transaction) {
+	e.PutUvarint(uint64(len(transactions)))
+	for _, transaction := range transactions {
+		writeTransaction(e, transaction)
+	}
+}
+
+func readTransactions(d *nextutils.Decoder) []Transaction {
+	count := d.Count()
+	if count == 0 {
+		return nil
+	}
+	transactions := make([]Transaction, 0, count)
+	for i := 0; i < count && d.Err() == nil; i++ {
+		transactions = append(transactions, readTransaction(d))
+	}
+	return transactions
+}
+
+func writeBlock(e *nextutils.Encoder, block Block) {
+	e.PutString(block.Id)
+	e.PutVarint(block.Timestamp)
+	e.PutString(block.PreviousHash)
+	e.PutString(block.Hash)
+	e.PutString(block.Data)
+	e.PutString(block.TransactionHash)
+	e.PutVarint(block.Nonce)
+	writeTransactions(e, block.Transactions)
+	writeTransactions(e, block.HeadTransactions)
+	e.PutUvarint(uint64(block.Ruleset.Bits))
+	e.PutVarint(int64(block.Ruleset.MaxTransactions))
+	e.PutVarint(int64(block.Ruleset.Version))
+	e.PutVarint(block.Ruleset.InitialReward)
+	e.PutVarint(int64(block.Ruleset.CoinbaseMaturity))
+	e.PutVarint(int64(block.Ruleset.MaxBlockSize))
+	e.PutString(block.Currency)
+	e.PutVarint(int64(block.BlockHeight))
+}
+
+func readBlock(d *nextutils.Decoder) Block {
+	return Block{
+		Id:               d.String(),
+		Timestamp:        d.Varint(),
+		PreviousHash:     d.String(),
+		Hash:             d.String(),
+		Data:             d.String(),
+		TransactionHash:  d.String(),
+		Nonce:            d.Varint(),
+		Transactions:     readTransactions(d),
+		HeadTransactions: readTransactions(d),
+		Ruleset: RuleSet{
+			Bits:             uint32(d.Uvarint()),
+			MaxTransactions:  int(d.Varint()),
+			Version:          int(d.Varint()),
+			InitialReward:    d.Varint(),
+			CoinbaseMaturity: int(d.Varint()),
+			MaxBlockSize:     int(d.Varint()),
+		},
+		Currency:    d.String(),
+		BlockHeight: int(d.Varint()),
+	}
+}
+
+func readVersion(d *nextutils.Decoder) error {
+	if version := d.Byte(); d.Err() == nil && version != nextutils.EncodingVersion {
+		return fmt.Errorf("unsupported encoding version %d", version)
+	}
+	return d.Err()
+}
+
+// * ENCODE / DECODE BLOCK * //
+
+func EncodeBlock(block Block) []byte {
+	var e nextutils.Encoder
+	e.PutByte(nextutils.EncodingVersion)
+	writeBlock(&e, block)
+	return e.Bytes()
+}
+
+func DecodeBlock(data []byte) (Block, error) {
+	d := nextutils.NewDecoder(data)
+	if err := readVersion(d); err != nil {
+		return Block{}, err
+	}
+	block := readBlock(d)
+	if err := d.Finish(); err != nil {
+		return Block{}, fmt.Errorf("invalid block encoding: %v", err)
+	}
+	return block, nil
+}
+
+// * ENCODE / DECODE TRANSACTION * //
+
+func EncodeTransaction(transaction Transaction) []byte {
+	var e nextutils.Encoder
+	e.PutByte(nextutils.EncodingVersion)
+	writeTransaction(&e, transaction)
+	return e.Bytes()
+}
+
+func DecodeTransaction(data []byte) (Transaction, error) {
+	d := nextutils.NewDecoder(data)
+	if err := readVersion(d); err != nil {
+		return Transaction{}, err
+	}
+	transaction := readTransaction(d)
+	if err := d.Finish(); err != nil {
+		return Transaction{}, fmt.Errorf("invalid transaction encoding: %v", err)
+	}
+	return transaction, nil
+}
+
+// * DECODE STORED BLOCK * //
+// ? Segmentdateien und Archive älterer Versionen enthalten JSON statt der Binärkodierung
+
+func decodeStoredBlock(payload []byte) (Block, error) {
+	if len(payload) > 0 && payload[0] == '{' {
+		var block Block
+		err := json.Unmarshal(payload, &block)
+		return block, err
+	}
+	return DecodeBlock(payload)
+}
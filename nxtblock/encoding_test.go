@@ -0,0 +1,295 @@
+package nxtblock
+
+import (
+	"encoding/hex"
+	"nxtchain/nextutils"
+	"nxtchain/nxtutxodb"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// * TEST DATA * //
+// ? Leere Listen und Bytes werden als nil dekodiert, die Testdaten verwenden daher nil.
+
+func testInput() TInput {
+	return TInput{Txid: "t", Index: 0, Signature: []byte{1, 2}, PublicKey: []byte{3}}
+}
+
+func testOutput() TOutput {
+	return TOutput{Index: 1, Amount: 5, ReceiverAddr: "ab"}
+}
+
+func testTransaction() Transaction {
+	return Transaction{
+		ID:        "id",
+		Timestamp: 10,
+		Hash:      "h",
+		Inputs:    []TInput{testInput()},
+		Outputs:   []TOutput{testOutput()},
+	}
+}
+
+func testUTXO() nxtutxodb.UTXO {
+	return nxtutxodb.UTXO{Txid: "t", Index: 1, Amount: 5, PubKey: "p", BlockHeight: 3, IsHeadTransaction: true}
+}
+
+func testBlock() Block {
+	return Block{
+		Id:              "b",
+		Timestamp:       2,
+		PreviousHash:    "p",
+		Hash:            "b",
+		Data:            "d",
+		TransactionHash: "m",
+		Nonce:           7,
+		Transactions:    []Transaction{testTransaction()},
+		HeadTransactions: []Transaction{{
+			ID:      "c",
+			Hash:    "c",
+			Outputs: []TOutput{{Index: 0, Amount: 50, ReceiverAddr: "x"}},
+		}},
+		Ruleset: RuleSet{
+			Bits:             0x1d00ffff,
+			MaxTransactions:  10,
+			Version:          0,
+			InitialReward:    100,
+			CoinbaseMaturity: 2,
+			MaxBlockSize:     1000,
+		},
+		Currency:    "NXT",
+		BlockHeight: 1,
+	}
+}
+
+// * GOLDEN VECTORS (EncodingVersion 1) * //
+// ? Ganzzahlen sind zigzag Varints (5 -> 0a), Strings und Bytes Länge + Inhalt, Listen Anzahl +
+// ? Elemente. Ändert sich eines dieser Bytes, ist das Format nicht mehr kompatibel.
+
+const goldenTInput = "0174" + "00" + "020102" + "0103"
+const goldenTOutput = "02" + "0a" + "026162"
+const goldenTransactionBody = "026964" + "14" + "0168" + "01" + goldenTInput + "01" + goldenTOutput
+const goldenTransaction = "01" + goldenTransactionBody
+const goldenUTXO = "01" + "0174" + "02" + "0a" + "0170" + "06" + "01"
+const goldenBlock = "01" + "0162" + "04" + "0170" + "0162" + "0164" + "016d" + "0e" +
+	"01" + goldenTransactionBody +
+	"01" + "0163" + "00" + "0163" + "00" + "01" + "00" + "64" + "0178" +
+	"ffff83e801" + "14" + "00" + "c801" + "04" + "d00f" +
+	"034e5854" + "02"
+
+func mustDecodeHex(t *testing.T, value string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(value)
+	if err != nil {
+		t.Fatalf("invalid golden vector %q: %v", value, err)
+	}
+	return data
+}
+
+func TestGoldenTInput(t *testing.T) {
+	var e nextutils.Encoder
+	writeTInput(&e, testInput())
+	if got := hex.EncodeToString(e.Bytes()); got != goldenTInput {
+		t.Fatalf("TInput encoding = %s, want %s", got, goldenTInput)
+	}
+
+	d := nextutils.NewDecoder(mustDecodeHex(t, goldenTInput))
+	input := readTInput(d)
+	if err := d.Finish(); err != nil {
+		t.Fatalf("decoding golden TInput: %v", err)
+	}
+	if !reflect.DeepEqual(input, testInput()) {
+		t.Fatalf("decoded TInput = %+v, want %+v", input, testInput())
+	}
+}
+
+func TestGoldenTOutput(t *testing.T) {
+	var e nextutils.Encoder
+	writeTOutput(&e, testOutput())
+	if got := hex.EncodeToString(e.Bytes()); got != goldenTOutput {
+		t.Fatalf("TOutput encoding = %s, want %s", got, goldenTOutput)
+	}
+
+	d := nextutils.NewDecoder(mustDecodeHex(t, goldenTOutput))
+	output := readTOutput(d)
+	if err := d.Finish(); err != nil {
+		t.Fatalf("decoding golden TOutput: %v", err)
+	}
+	if !reflect.DeepEqual(output, testOutput()) {
+		t.Fatalf("decoded TOutput = %+v, want %+v", output, testOutput())
+	}
+}
+
+func TestGoldenTransaction(t *testing.T) {
+	if got := hex.EncodeToString(EncodeTransaction(testTransaction())); got != goldenTransaction {
+		t.Fatalf("transaction encoding = %s, want %s", got, goldenTransaction)
+	}
+	transaction, err := DecodeTransaction(mustDecodeHex(t, goldenTransaction))
+	if err != nil {
+		t.Fatalf("decoding golden transaction: %v", err)
+	}
+	if !reflect.DeepEqual(transaction, testTransaction()) {
+		t.Fatalf("decoded transaction = %+v, want %+v", transaction, testTransaction())
+	}
+}
+
+func TestGoldenUTXO(t *testing.T) {
+	if got := hex.EncodeToString(nxtutxodb.EncodeUTXO(testUTXO())); got != goldenUTXO {
+		t.Fatalf("utxo encoding = %s, want %s", got, goldenUTXO)
+	}
+	utxo, err := nxtutxodb.DecodeUTXO(mustDecodeHex(t, goldenUTXO))
+	if err != nil {
+		t.Fatalf("decoding golden utxo: %v", err)
+	}
+	if utxo != testUTXO() {
+		t.Fatalf("decoded utxo = %+v, want %+v", utxo, testUTXO())
+	}
+}
+
+func TestGoldenBlock(t *testing.T) {
+	if got := hex.EncodeToString(EncodeBlock(testBlock())); got != goldenBlock {
+		t.Fatalf("block encoding = %s, want %s", got, goldenBlock)
+	}
+	block, err := DecodeBlock(mustDecodeHex(t, goldenBlock))
+	if err != nil {
+		t.Fatalf("decoding golden block: %v", err)
+	}
+	if !reflect.DeepEqual(block, testBlock()) {
+		t.Fatalf("decoded block = %+v, want %+v", block, testBlock())
+	}
+}
+
+// * ROUND TRIP * //
+
+func TestBlockRoundTrip(t *testing.T) {
+	blocks := []Block{
+		{},
+		testBlock(),
+		{
+			Id:           strings.Repeat("f", 64),
+			Timestamp:    -1,
+			PreviousHash: "GENESIS",
+			Nonce:        1 << 62,
+			Transactions: []Transaction{testTransaction(), {ID: "empty"}},
+			Ruleset:      RuleSet{Bits: 0xffffffff, InitialReward: -5},
+			BlockHeight:  1 << 30,
+		},
+	}
+	for _, block := range blocks {
+		decoded, err := DecodeBlock(EncodeBlock(block))
+		if err != nil {
+			t.Fatalf("round trip of block %q: %v", block.Id, err)
+		}
+		if !reflect.DeepEqual(decoded, block) {
+			t.Fatalf("round trip of block %q = %+v, want %+v", block.Id, decoded, block)
+		}
+	}
+}
+
+func TestTransactionRoundTrip(t *testing.T) {
+	transactions := []Transaction{
+		{},
+		testTransaction(),
+		{
+			ID:        "big",
+			Timestamp: -1 << 40,
+			Inputs:    []TInput{{Txid: "a", Index: -1, Signature: make([]byte, 4000), PublicKey: make([]byte, 2000)}, testInput()},
+			Outputs:   []TOutput{{Index: 1 << 20, Amount: int64(MaxAmount), ReceiverAddr: "r"}, testOutput()},
+		},
+	}
+	for _, transaction := range transactions {
+		decoded, err := DecodeTransaction(EncodeTransaction(transaction))
+		if err != nil {
+			t.Fatalf("round trip of transaction %q: %v", transaction.ID, err)
+		}
+		if !reflect.DeepEqual(decoded, transaction) {
+			t.Fatalf("round trip of transaction %q = %+v, want %+v", transaction.ID, decoded, transaction)
+		}
+	}
+}
+
+func TestUTXORoundTrip(t *testing.T) {
+	utxos := []nxtutxodb.UTXO{{}, testUTXO(), {Txid: strings.Repeat("a", 64), Index: 3, Amount: -7, BlockHeight: 1 << 30}}
+	for _, utxo := range utxos {
+		decoded, err := nxtutxodb.DecodeUTXO(nxtutxodb.EncodeUTXO(utxo))
+		if err != nil {
+			t.Fatalf("round trip of utxo %+v: %v", utxo, err)
+		}
+		if decoded != utxo {
+			t.Fatalf("round trip of utxo = %+v, want %+v", decoded, utxo)
+		}
+	}
+}
+
+// * INVALID INPUT * //
+
+func TestDecodeTruncated(t *testing.T) {
+	encodings := map[string]struct {
+		data   []byte
+		decode func([]byte) error
+	}{
+		"block": {EncodeBlock(testBlock()), func(data []byte) error {
+			_, err := DecodeBlock(data)
+			return err
+		}},
+		"transaction": {EncodeTransaction(testTransaction()), func(data []byte) error {
+			_, err := DecodeTransaction(data)
+			return err
+		}},
+		"utxo": {nxtutxodb.EncodeUTXO(testUTXO()), func(data []byte) error {
+			_, err := nxtutxodb.DecodeUTXO(data)
+			return err
+		}},
+	}
+	for name, encoding := range encodings {
+		for length := 0; length < len(encoding.data); length++ {
+			if err := encoding.decode(encoding.data[:length]); err == nil {
+				t.Fatalf("%s truncated to %d of %d bytes decoded without error", name, length, len(encoding.data))
+			}
+		}
+		if err := encoding.decode(append(encoding.data, 0)); err == nil {
+			t.Fatalf("%s with a trailing byte decoded without error", name)
+		}
+	}
+}
+
+func TestDecodeTooLargeCount(t *testing.T) {
+	cases := map[string]string{
+		// ? Transaktion "id" mit 2^32-1 Inputs
+		"input count": "01" + "026964" + "14" + "0168" + "ffffffff0f",
+		// ? Transaktion mit einem Input, dessen Signatur 2^62 Bytes lang sein soll
+		"signature length": "01" + "026964" + "14" + "0168" + "01" + "0174" + "00" + "808080808080808040",
+		// ? Block, dessen Id länger ist als die restlichen Daten
+		"string length": "01" + "7f" + "62",
+	}
+	for name, value := range cases {
+		data := mustDecodeHex(t, value)
+		_, txErr := DecodeTransaction(data)
+		_, blockErr := DecodeBlock(data)
+		if txErr == nil || blockErr == nil {
+			t.Fatalf("%s: decoded without error (transaction: %v, block: %v)", name, txErr, blockErr)
+		}
+	}
+}
+
+func TestDecodeUnknownVersion(t *testing.T) {
+	for _, version := range []byte{0, 2, 0xff} {
+		block := EncodeBlock(testBlock())
+		block[0] = version
+		if _, err := DecodeBlock(block); err == nil || !strings.Contains(err.Error(), "unsupported encoding version") {
+			t.Fatalf("block with version %d: got error %v", version, err)
+		}
+
+		transaction := EncodeTransaction(testTransaction())
+		transaction[0] = version
+		if _, err := DecodeTransaction(transaction); err == nil || !strings.Contains(err.Error(), "unsupported encoding version") {
+			t.Fatalf("transaction with version %d: got error %v", version, err)
+		}
+
+		utxo := nxtutxodb.EncodeUTXO(testUTXO())
+		utxo[0] = version
+		if _, err := nxtutxodb.DecodeUTXO(utxo); err == nil || !strings.Contains(err.Error(), "unsupported encoding version") {
+			t.Fatalf("utxo with version %d: got error %v", version, err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package nxtblock
+
+import (
+	"fmt"
+	"nxtchain/pqckpg_api"
+	"strings"
+)
+
+// * FEE POLICY * //
+// ? Die Größe einer Transaktion ist die Länge ihrer Binärkodierung (EncodeTransaction), Gebühren
+// ? werden als Rate in Basiseinheiten pro Byte angegeben. Node und Miner nehmen nur Transaktionen
+// ? an, deren Gebühr mindestens MinRelayFeeRate * Größe ist. Das ist keine Konsensregel: Blöcke
+// ? mit günstigeren Transaktionen bleiben gültig.
+
+const DefaultMinRelayFeeRate Amount = 1000 // Basiseinheiten pro Byte
+
+var MinRelayFeeRate = DefaultMinRelayFeeRate
+
+// * TRANSACTION SIZE * //
+
+func TransactionSize(transaction Transaction) int {
+	return len(EncodeTransaction(transaction))
+}
+
+// ? Größe nach dem Signieren: fehlende Signaturen, Hash und ID werden mit ihrer festen Länge
+// ? angenommen (für die Gebührenberechnung vor dem Signieren)
+func EstimateTransactionSize(transaction Transaction) int {
+	inputs := make([]TInput, len(transaction.Inputs))
+	for i, input := range transaction.Inputs {
+		if len(input.Signature) == 0 {
+			input.Signature = make([]byte, pqckpg_api.SignatureSize())
+		}
+		inputs[i] = input
+	}
+	transaction.Inputs = inputs
+	if transaction.Hash == "" {
+		transaction.Hash = strings.Repeat("0", 64)
+	}
+	if transaction.ID == "" {
+		transaction.ID = strings.Repeat("0", 64)
+	}
+	return TransactionSize(transaction)
+}
+
+// * FEE FOR SIZE * //
+
+func CalculateFeeForSize(size int, feeRate Amount) (Amount, error) {
+	return feeRate.Mul(int64(size))
+}
+
+// * CHECK RELAY FEE * //
+
+func CheckRelayFee(transaction Transaction, minFeeRate Amount) error {
+	fee, err := CalculateTransactionFee(transaction)
+	if err != nil {
+		return err
+	}
+	size := TransactionSize(transaction)
+	required, err := CalculateFeeForSize(size, minFeeRate)
+	if err != nil {
+		return err
+	}
+	if fee < required {
+		return fmt.Errorf("transaction fee %s NXT is below the minimum relay fee %s NXT (%d bytes at %d per byte)", fee, required, size, int64(minFeeRate))
+	}
+	return nil
+}
@@ -17,20 +17,15 @@ type Wallet struct {
 // * SAVE BLOCK * //
 
 func SaveBlock(block Block, dir string) string {
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		log.Printf("Error creating directory: %v", err)
-		return ""
-	}
-
-	blockJSON, err := json.Marshal(block)
+	store, err := GetBlockStore(dir)
 	if err != nil {
-		log.Printf("Error marshaling block: %v", err)
+		log.Printf("Error opening block store: %v", err)
 		return ""
 	}
 
-	path := filepath.Join(dir, block.Hash+".json")
-	if err := os.WriteFile(path, blockJSON, 0644); err != nil {
-		log.Printf("Error writing block file: %v", err)
+	path, err := store.Put(block)
+	if err != nil {
+		log.Printf("Error saving block: %v", err)
 		return ""
 	}
 	return path
@@ -61,43 +56,26 @@ func LoadBlock(hash, dir string) (Block, error) {
 // * DELETE BLOCK * //
 
 func DeleteBlock(hash, dir string) error {
-	filename := filepath.Join(dir, hash+".json")
-	return os.Remove(filename)
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return err
+	}
+	return store.Delete(hash)
 }
 
 // * GET LATEST BLOCK * //
 
 func GetLatestBlock(dir string, ignoreEmpty bool) (Block, error) {
 	nextutils.Debug("Getting latest block from %s", filepath.Clean(dir))
-	files, err := os.ReadDir(dir)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		nextutils.Error("Error creating directory: %v", err)
-		return Block{}, err
-	}
+	store, err := GetBlockStore(dir)
 	if err != nil {
-		nextutils.Error("Error reading directory: %v", err)
+		nextutils.Error("Error opening block store: %v", err)
 		return Block{}, err
 	}
-	nextutils.Debug("Found %d files", len(files))
-
-	var latestBlock Block
-	for _, file := range files {
-		nextutils.Debug("Checking file %s", file.Name())
-		if file.IsDir() {
-			nextutils.Debug("Skipping non-directory %s", file.Name())
-			continue
-		}
-
-		block, err := LoadBlock(file.Name(), dir)
-		nextutils.Debug("Loaded block %s", block.Hash)
-		if err != nil {
-			nextutils.Error("Error loading block: %v", err)
-			continue
-		}
 
-		if block.Timestamp > latestBlock.Timestamp {
-			latestBlock = block
-		}
+	latestBlock, err := store.Tip()
+	if err != nil && !os.IsNotExist(err) {
+		nextutils.Error("Error loading block: %v", err)
 	}
 	if latestBlock.Hash == "" && !ignoreEmpty {
 		return Block{}, os.ErrNotExist
@@ -107,38 +85,36 @@ func GetLatestBlock(dir string, ignoreEmpty bool) (Block, error) {
 }
 
 // * GET LATEST BLOCKS * //
+// ? Gibt die letzten count Blöcke der Kette zurück (aufsteigend nach Höhe)
 
 func GetLatestBlocks(dir string, count int) ([]Block, error) {
-	files, err := os.ReadDir(dir)
+	store, err := GetBlockStore(dir)
 	if err != nil {
 		return nil, err
 	}
 
 	var blocks []Block
-	for _, file := range files {
-		block, err := LoadBlock(file.Name(), dir)
+	for height := store.Height(); height > 0 && len(blocks) < count; height-- {
+		block, err := store.GetByHeight(height)
 		if err != nil {
 			continue
 		}
-		blocks = append(blocks, block)
+		blocks = append([]Block{block}, blocks...)
 	}
 	if len(blocks) == 0 {
 		return nil, os.ErrNotExist
 	}
-	if count > len(blocks) {
-		count = len(blocks)
-	}
-	return blocks[:count], nil
+	return blocks, nil
 }
 
 // * GET LOCAL BLOCKHEIGHT * //
 
 func GetLocalBlockHeight(dir string) int {
-	ltstblock, err := GetLatestBlock(dir, false)
+	store, err := GetBlockStore(dir)
 	if err != nil {
 		return 0
 	}
-	return ltstblock.BlockHeight
+	return store.Height()
 }
 
 // * GET BLOCK BY HEIGHT * //
@@ -152,25 +128,11 @@ func GetBlockByHeight(height int, dir string) (Block, error) {
 		return GetLatestBlock(dir, false)
 	}
 
-	files, err := os.ReadDir(dir)
+	store, err := GetBlockStore(dir)
 	if err != nil {
 		return Block{}, err
 	}
-
-	if len(files) == 0 {
-		return Block{}, os.ErrNotExist
-	}
-
-	for _, file := range files {
-		block, err := LoadBlock(file.Name(), dir)
-		if err != nil {
-			continue
-		}
-		if block.BlockHeight == height {
-			return block, nil
-		}
-	}
-	return Block{}, os.ErrNotExist
+	return store.GetByHeight(height)
 }
 
 // * SAVE WALLET * //
@@ -188,7 +150,7 @@ func SaveWallet(wallet Wallet, dir string) string {
 	}
 
 	path := filepath.Join(dir, GenerateWalletAddress(wallet.PublicKey)+".json")
-	if err := os.WriteFile(path, walletJSON, 0644); err != nil {
+	if err := nextutils.WriteFileAtomic(path, walletJSON, 0600); err != nil {
 		log.Printf("Error writing wallet file: %v", err)
 		return ""
 	}
@@ -246,27 +208,17 @@ func GetAllWallets(dir string) ([]Wallet, error) {
 // * GET ALL TRANSACTIONS BY WALLET (Getting input & outputs) * //
 
 func GetAllTransactionsFromBlocks(blockdir string, walletaddr string) map[string]Transaction {
-	files, err := os.ReadDir(blockdir)
 	transactions := make(map[string]Transaction)
+	blocks, err := GetAllBlocks(blockdir)
 	if err != nil {
-		log.Printf("Error reading directory: %v", err)
+		log.Printf("Error reading blocks: %v", err)
 		return transactions
 	}
 
-	var blocks []Block
-
-	for _, file := range files {
-		block, err := LoadBlock(file.Name(), blockdir)
-		if err != nil {
-			continue
-		}
-		blocks = append(blocks, block)
-	}
-
 	for _, block := range blocks {
 		for _, tx := range block.Transactions {
 			for _, input := range tx.Inputs {
-				if string(input.PublicKey) == walletaddr {
+				if GenerateWalletAddress(input.PublicKey) == walletaddr {
 					transactions[tx.Hash] = tx
 				}
 			}
@@ -284,34 +236,35 @@ func GetAllTransactionsFromBlocks(blockdir string, walletaddr string) map[string
 // * GET ALL BLOCKS * //
 
 func GetAllBlocks(dir string) ([]Block, error) {
-	files, err := os.ReadDir(dir)
+	store, err := GetBlockStore(dir)
 	if err != nil {
 		return nil, err
 	}
 
 	var blocks []Block
-	for _, file := range files {
-		block, err := LoadBlock(file.Name(), dir)
-		if err != nil {
-			continue
-		}
+	err = store.Iterate(func(block Block) error {
 		blocks = append(blocks, block)
-	}
-	return blocks, nil
+		return nil
+	})
+	return blocks, err
 }
 
 // * GET BLOCK BY HASH * //
 
 func GetBlockByHash(dir, hash string) (Block, error) {
-	files, err := os.ReadDir(dir)
+	store, err := GetBlockStore(dir)
 	if err != nil {
 		return Block{}, err
 	}
+	return store.Get(hash)
+}
 
-	for _, file := range files {
-		if file.Name() == hash+".json" {
-			return LoadBlock(hash, dir)
-		}
+// * GET BLOCK COUNT * //
+
+func GetBlockCount(dir string) (int, error) {
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return 0, err
 	}
-	return Block{}, os.ErrNotExist
+	return store.Count(), nil
 }
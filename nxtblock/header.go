@@ -0,0 +1,137 @@
+package nxtblock
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+)
+
+// * BLOCK HEADER * //
+// ? Kanonischer Header, über den der Blockhash (Proof of Work) gebildet wird. Feste Breite,
+// ? Big Endian, BlockHeaderSize Byte:
+// ? Version (4) | Height (4) | PreviousHash (32) | MerkleRoot (32) | Timestamp (8) | Target (4) | Nonce (8)
+// ? Der erste Block hat 32 Null-Bytes als PreviousHash ("GENESIS"). Die Merkle Root deckt alle
+// ? Transaktionen inklusive Head-Transaktion ab (Block.TransactionHash). Id ist gleich dem Hash,
+// ? Data und Currency gehören nicht zum Header und sind keine Konsensfelder.
+
+const BlockHeaderSize = 92
+
+const headerNonceOffset = BlockHeaderSize - 8
+
+type BlockHeader struct {
+	Version      uint32
+	Height       uint32
+	PreviousHash [32]byte
+	MerkleRoot   [32]byte
+	Timestamp    int64
+	Target       uint32
+	Nonce        uint64
+}
+
+// * HEADER BYTES * //
+
+func (h BlockHeader) Bytes() []byte {
+	data := make([]byte, BlockHeaderSize)
+	binary.BigEndian.PutUint32(data[0:], h.Version)
+	binary.BigEndian.PutUint32(data[4:], h.Height)
+	copy(data[8:40], h.PreviousHash[:])
+	copy(data[40:72], h.MerkleRoot[:])
+	binary.BigEndian.PutUint64(data[72:], uint64(h.Timestamp))
+	binary.BigEndian.PutUint32(data[80:], h.Target)
+	binary.BigEndian.PutUint64(data[headerNonceOffset:], h.Nonce)
+	return data
+}
+
+// * HEADER HASH * //
+
+func (h BlockHeader) Hash() string {
+	return hashHeaderBytes(h.Bytes())
+}
+
+func hashHeaderBytes(data []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// * GET BLOCK HEADER * //
+// ? Baut den Header aus den Feldern eines Blocks. Für die Merkle Root wird Block.TransactionHash
+// ? verwendet, damit auch geprunte Blöcke (nur Header) geprüft werden können.
+
+func GetBlockHeader(block Block) (BlockHeader, error) {
+	var header BlockHeader
+	if block.Ruleset.Version < 0 || int64(block.Ruleset.Version) > math.MaxUint32 {
+		return header, fmt.Errorf("invalid block version %d", block.Ruleset.Version)
+	}
+	if block.BlockHeight < 0 || int64(block.BlockHeight) > math.MaxUint32 {
+		return header, fmt.Errorf("invalid block height %d", block.BlockHeight)
+	}
+	if block.Nonce < 0 {
+		return header, fmt.Errorf("invalid block nonce %d", block.Nonce)
+	}
+
+	header.Version = uint32(block.Ruleset.Version)
+	header.Height = uint32(block.BlockHeight)
+	header.Timestamp = block.Timestamp
+	header.Target = block.Ruleset.Bits
+	header.Nonce = uint64(block.Nonce)
+
+	if block.PreviousHash != "GENESIS" {
+		previousHash, err := parseBlockHash(block.PreviousHash)
+		if err != nil {
+			return header, fmt.Errorf("invalid previous hash: %v", err)
+		}
+		header.PreviousHash = previousHash
+	}
+	merkleRoot, err := parseBlockHash(block.TransactionHash)
+	if err != nil {
+		return header, fmt.Errorf("invalid merkle root: %v", err)
+	}
+	header.MerkleRoot = merkleRoot
+	return header, nil
+}
+
+func parseBlockHash(hash string) ([32]byte, error) {
+	var value [32]byte
+	data, err := hex.DecodeString(hash)
+	if err != nil {
+		return value, err
+	}
+	if len(data) != len(value) {
+		return value, fmt.Errorf("hash %q has %d bytes, want %d", hash, len(data), len(value))
+	}
+	copy(value[:], data)
+	return value, nil
+}
+
+// * BLOCK TRANSACTIONS * //
+// ? Alle Transaktionen eines Blocks in Merkle-Reihenfolge: Head-Transaktionen zuerst
+
+func blockTransactions(block Block) []Transaction {
+	transactions := make([]Transaction, 0, len(block.HeadTransactions)+len(block.Transactions))
+	transactions = append(transactions, block.HeadTransactions...)
+	return append(transactions, block.Transactions...)
+}
+
+// * MERKLE ROOT * //
+
+func CalculateMerkleRoot(block Block) string {
+	return CalculateTransactionHash(blockTransactions(block))
+}
+
+// * CHECK DUPLICATE TRANSACTIONS * //
+// ? Bei ungerader Anzahl verdoppelt die Merkle Root das letzte Blatt, [a, b, c] und [a, b, c, c]
+// ? haben also dieselbe Root und denselben Blockhash (CVE-2012-2459). Blöcke mit doppelten
+// ? Transaktionen werden abgelehnt, bevor sie gespeichert oder als Orphan vorgehalten werden,
+// ? sonst würde die manipulierte Variante den gültigen Block mit gleichem Hash blockieren.
+
+func checkDuplicateTransactions(block Block) error {
+	seen := make(map[string]bool)
+	for _, transaction := range blockTransactions(block) {
+		if seen[transaction.ID] {
+			return fmt.Errorf("duplicate transaction %s in block %s", transaction.ID, block.Hash)
+		}
+		seen[transaction.ID] = true
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package nxtblock
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"nxtchain/nextutils"
+	"nxtchain/nxtutxodb"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// * BLOCK JOURNAL * //
+// ? Write-ahead Journal unter <block_dir>/index/journal.log. Vor dem Übernehmen eines Blocks
+// ? wird "begin" geschrieben, nach Undo-Daten + Block speichern + UTXO Update "commit" (oder "abort").
+// ? Ein "begin" ohne Abschluss bedeutet, dass der Prozess mitten im Übernehmen abgestürzt ist.
+
+const blockJournalFile = "journal.log"
+
+type journalEntry struct {
+	Op     string `json:"op"`
+	Hash   string `json:"hash"`
+	Height int    `json:"height,omitempty"`
+	Stored bool   `json:"stored,omitempty"` // Block war vorher schon (als Seitenzweig) gespeichert
+}
+
+var acceptMutex sync.Mutex
+
+func journalPath(dir string) string {
+	return filepath.Join(dir, blockIndexDir, blockJournalFile)
+}
+
+func writeJournal(dir string, entry journalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, blockIndexDir), 0755); err != nil {
+		return err
+	}
+	return nextutils.AppendFileSync(journalPath(dir), append(line, '\n'), 0644)
+}
+
+// * PENDING JOURNAL ENTRIES * //
+// ? Gibt alle "begin" Einträge ohne "commit"/"abort" zurück
+
+func pendingJournalEntries(dir string) ([]journalEntry, error) {
+	file, err := os.Open(journalPath(dir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var order []string
+	open := make(map[string]journalEntry)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// ? Eine abgeschnittene letzte Zeile stammt von einem Absturz während des Schreibens
+			nextutils.Error("Skipping damaged journal entry: %v", err)
+			continue
+		}
+		switch entry.Op {
+		case "begin":
+			if _, exists := open[entry.Hash]; !exists {
+				order = append(order, entry.Hash)
+			}
+			open[entry.Hash] = entry
+		case "commit", "abort":
+			delete(open, entry.Hash)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var pending []journalEntry
+	for _, hash := range order {
+		if entry, exists := open[hash]; exists {
+			pending = append(pending, entry)
+		}
+	}
+	return pending, nil
+}
+
+// * CONNECT BLOCK * //
+// ? Validiert einen Block, dessen Vorgänger der aktuelle Tip ist, gegen eine UTXO Sicht und
+// ? übernimmt ihn erst danach (Undo-Daten + Block speichern + Sicht committen + Tip setzen) als
+// ? eine Einheit. Ein ungültiger Block hinterlässt keine Änderungen in der UTXO Datenbank.
+// ? stored gibt an, ob der Block schon als Seitenzweig gespeichert war (dann wird er bei einer
+// ? Recovery nicht gelöscht).
+// ? Der Aufrufer hält acceptMutex.
+
+func connectBlock(block Block, dir string, ruleset RuleSet, store BlockStore, stored bool) error {
+	if err := writeJournal(dir, journalEntry{Op: "begin", Hash: block.Hash, Height: block.BlockHeight, Stored: stored}); err != nil {
+		return fmt.Errorf("error writing block journal: %v", err)
+	}
+
+	view := nxtutxodb.NewView()
+	valid, err := validateBlock(block, dir, ruleset, view)
+	if err == nil && !valid {
+		err = fmt.Errorf("invalid block %s", block.Hash)
+	}
+	var undo BlockUndo
+	if err == nil {
+		// ? Die Inputs sind bis zum Commit noch im UTXO Set
+		undo, err = CreateBlockUndo(block)
+	}
+	if err != nil {
+		if jerr := writeJournal(dir, journalEntry{Op: "abort", Hash: block.Hash}); jerr != nil {
+			nextutils.Error("Error writing block journal: %v", jerr)
+		}
+		return err
+	}
+
+	if err := SaveBlockUndo(undo, dir); err != nil {
+		return fmt.Errorf("error saving undo data for block %s: %v", block.Hash, err)
+	}
+	if path := SaveBlock(block, dir); path == "" {
+		return fmt.Errorf("error saving block %s", block.Hash)
+	}
+	if err := view.Commit(nxtutxodb.BlockRef{Hash: block.Hash, Height: block.BlockHeight}); err != nil {
+		return fmt.Errorf("error updating utxo database: %v", err)
+	}
+	if err := store.SetTip(block.Hash); err != nil {
+		return fmt.Errorf("error updating chain tip: %v", err)
+	}
+	indexBlockTransactions(dir, block)
+	indexBlockAddresses(dir, block)
+
+	if err := writeJournal(dir, journalEntry{Op: "commit", Hash: block.Hash}); err != nil {
+		return fmt.Errorf("error writing block journal: %v", err)
+	}
+	return nil
+}
+
+// * RECOVER BLOCK STORE * //
+// ? Startup-Pass (nach nxtutxodb.Open): Blöcke, deren Übernahme nicht abgeschlossen wurde, werden
+// ? abgeschlossen, wenn die UTXO Datenbank den Block schon enthält. Sonst wird der Block wieder
+// ? entfernt und beim Sync neu geladen.
+
+func RecoverBlockStore(dir string) ([]string, error) {
+	for _, tmpDir := range []string{dir, filepath.Join(dir, blockIndexDir), filepath.Join(dir, blockUndoDir)} {
+		if removed, err := nextutils.RemoveTempFiles(tmpDir); err != nil {
+			return nil, err
+		} else if len(removed) > 0 {
+			nextutils.Debug("Removed %d leftover temporary files from %s", len(removed), tmpDir)
+		}
+	}
+
+	pending, err := pendingJournalEntries(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading block journal: %v", err)
+	}
+
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var repaired []string
+	for _, entry := range pending {
+		if store.Has(entry.Hash) && nxtutxodb.Tip().Hash == entry.Hash {
+			nextutils.Error("Block %s (height %d) was applied but not committed, completing", entry.Hash, entry.Height)
+			if err := writeJournal(dir, journalEntry{Op: "commit", Hash: entry.Hash}); err != nil {
+				return repaired, fmt.Errorf("error writing block journal: %v", err)
+			}
+			repaired = append(repaired, entry.Hash)
+			continue
+		}
+		nextutils.Error("Block %s (height %d) was not fully applied, rolling back", entry.Hash, entry.Height)
+		if store.Has(entry.Hash) && !entry.Stored {
+			if err := store.Delete(entry.Hash); err != nil {
+				return repaired, fmt.Errorf("error removing half-applied block %s: %v", entry.Hash, err)
+			}
+		}
+		if err := DeleteBlockUndo(entry.Hash, dir); err != nil {
+			return repaired, fmt.Errorf("error removing undo data of block %s: %v", entry.Hash, err)
+		}
+		if err := writeJournal(dir, journalEntry{Op: "abort", Hash: entry.Hash}); err != nil {
+			return repaired, fmt.Errorf("error writing block journal: %v", err)
+		}
+		repaired = append(repaired, entry.Hash)
+	}
+	if err := syncChainTip(store); err != nil {
+		return repaired, err
+	}
+	return repaired, resetJournal(dir)
+}
+
+// ? Nach einem Absturz während eines Reorgs kann der Tip des Index einen Schritt hinter der
+// ? UTXO Datenbank liegen. Ist der UTXO-Tip ein gespeicherter Block, wird er aktiver Tip.
+func syncChainTip(store BlockStore) error {
+	tip := nxtutxodb.Tip()
+	if tip.Hash == "" || !store.Has(tip.Hash) {
+		return nil
+	}
+	if current, err := store.Tip(); err == nil && current.Hash == tip.Hash {
+		return nil
+	}
+	nextutils.Error("Chain tip does not match utxo database, switching to %s (height %d)", tip.Hash, tip.Height)
+	return store.SetTip(tip.Hash)
+}
+
+// ? Alle Einträge sind abgeschlossen, das Journal kann geleert werden
+func resetJournal(dir string) error {
+	if err := os.Remove(journalPath(dir)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package nxtblock
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"nxtchain/nextutils"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// * JSON BLOCK STORE * //
+// ? Ein Block pro Datei (<block_dir>/<hash>.json), das ursprüngliche Layout
+
+type jsonBlockStore struct {
+	dir   string
+	mutex sync.RWMutex
+	index *blockIndex
+}
+
+func openJSONBlockStore(dir string) (*jsonBlockStore, error) {
+	store := &jsonBlockStore{dir: dir, index: newBlockIndex(dir)}
+
+	loaded, err := store.index.load()
+	if err != nil {
+		nextutils.Error("Error loading block index, rebuilding: %v", err)
+	}
+
+	files, err := blockFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !loaded || len(files) != len(store.index.byHash) {
+		nextutils.Debug("Block index out of date (%d indexed, %d files), rebuilding...", len(store.index.byHash), len(files))
+		if err := store.Rebuild(); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+func blockFiles(dir string) ([]string, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		names = append(names, file.Name())
+	}
+	return names, nil
+}
+
+// * REBUILD INDEX * //
+// ? Liest alle Blockdateien einmal ein und schreibt den Index neu
+
+func (s *jsonBlockStore) Rebuild() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	files, err := blockFiles(s.dir)
+	if err != nil {
+		return err
+	}
+
+	var entries []blockIndexEntry
+	for _, name := range files {
+		block, err := LoadBlock(name, s.dir)
+		if err != nil {
+			// ? Abgeschnittene Dateien (z.B. nach einem Absturz) beiseite legen
+			nextutils.Error("Moving unreadable block file %s aside: %v", name, err)
+			if err := os.Rename(filepath.Join(s.dir, name), filepath.Join(s.dir, name+".corrupt")); err != nil {
+				return err
+			}
+			continue
+		}
+		entry := newIndexEntry(block)
+		entry.File = name
+		entries = append(entries, entry)
+	}
+	if err := s.index.rewrite(entries); err != nil {
+		return err
+	}
+	nextutils.Debug("Block index rebuilt: %d blocks, tip %s", len(s.index.byHash), s.index.tip)
+	return nil
+}
+
+// * PUT BLOCK * //
+
+func (s *jsonBlockStore) Put(block Block) (string, error) {
+	blockJSON, err := json.Marshal(block)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling block: %v", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// ? Vorhandene (evtl. geprunte) Blöcke nicht neu schreiben
+	if entry, exists := s.index.byHash[block.Hash]; exists {
+		return filepath.Join(s.dir, entry.File), nil
+	}
+	name := block.Hash + ".json"
+	path := filepath.Join(s.dir, name)
+	if err := nextutils.WriteFileAtomic(path, blockJSON, 0644); err != nil {
+		return "", fmt.Errorf("error writing block file: %v", err)
+	}
+
+	entry := newIndexEntry(block)
+	entry.File = name
+	if err := s.index.append(entry); err != nil {
+		return "", fmt.Errorf("error updating block index: %v", err)
+	}
+	return path, nil
+}
+
+// * DELETE BLOCK * //
+
+func (s *jsonBlockStore) Delete(hash string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, exists := s.index.byHash[hash]
+	if !exists {
+		return os.ErrNotExist
+	}
+	if err := os.Remove(filepath.Join(s.dir, entry.File)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := s.index.append(blockIndexEntry{Op: "delete", Hash: hash}); err != nil {
+		return fmt.Errorf("error updating block index: %v", err)
+	}
+	return nil
+}
+
+// * PRUNE BLOCK * //
+// ? Ersetzt die Blockdatei durch den Header des Blocks
+
+func (s *jsonBlockStore) Prune(hash string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, exists := s.index.byHash[hash]
+	if !exists {
+		return os.ErrNotExist
+	}
+	if entry.Pruned {
+		return nil
+	}
+	block, err := LoadBlock(entry.File, s.dir)
+	if err != nil {
+		return err
+	}
+	headerJSON, err := json.Marshal(blockHeader(block))
+	if err != nil {
+		return fmt.Errorf("error marshaling block header: %v", err)
+	}
+	if err := nextutils.WriteFileAtomic(filepath.Join(s.dir, entry.File), headerJSON, 0644); err != nil {
+		return fmt.Errorf("error writing block file: %v", err)
+	}
+	if err := s.index.append(blockIndexEntry{Op: "prune", Hash: hash}); err != nil {
+		return fmt.Errorf("error updating block index: %v", err)
+	}
+	return nil
+}
+
+// * PRUNED * //
+
+func (s *jsonBlockStore) Pruned(hash string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.index.byHash[hash].Pruned
+}
+
+// * GET BLOCK BY HASH * //
+
+func (s *jsonBlockStore) Get(hash string) (Block, error) {
+	s.mutex.RLock()
+	entry, exists := s.index.byHash[hash]
+	s.mutex.RUnlock()
+	if !exists {
+		return Block{}, os.ErrNotExist
+	}
+	return LoadBlock(entry.File, s.dir)
+}
+
+// * GET BLOCK BY HEIGHT * //
+
+func (s *jsonBlockStore) GetByHeight(height int) (Block, error) {
+	s.mutex.RLock()
+	hash, exists := s.index.byHeight[height]
+	s.mutex.RUnlock()
+	if !exists {
+		return Block{}, os.ErrNotExist
+	}
+	return s.Get(hash)
+}
+
+// * HAS BLOCK * //
+
+func (s *jsonBlockStore) Has(hash string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	_, exists := s.index.byHash[hash]
+	return exists
+}
+
+// * TIP * //
+
+func (s *jsonBlockStore) Tip() (Block, error) {
+	s.mutex.RLock()
+	tip := s.index.tip
+	s.mutex.RUnlock()
+	if tip == "" {
+		return Block{}, os.ErrNotExist
+	}
+	return s.Get(tip)
+}
+
+// * SET TIP (aktive Kette umstellen) * //
+
+func (s *jsonBlockStore) SetTip(hash string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.index.byHash[hash]; !exists && hash != "" {
+		return os.ErrNotExist
+	}
+	if s.index.tip == hash {
+		return nil
+	}
+	if err := s.index.append(blockIndexEntry{Op: "tip", Hash: hash}); err != nil {
+		return fmt.Errorf("error updating block index: %v", err)
+	}
+	return nil
+}
+
+// * CHAIN WORK * //
+
+func (s *jsonBlockStore) ChainWork(hash string) (*big.Int, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	work, exists := s.index.chainWork[hash]
+	if !exists {
+		return nil, false
+	}
+	return new(big.Int).Set(work), true
+}
+
+// * HEIGHT * //
+
+func (s *jsonBlockStore) Height() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.index.height()
+}
+
+// * COUNT * //
+
+func (s *jsonBlockStore) Count() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.index.byHeight)
+}
+
+// * ITERATE (aufsteigend nach Höhe) * //
+
+func (s *jsonBlockStore) Iterate(fn func(block Block) error) error {
+	s.mutex.RLock()
+	entries := s.index.sorted()
+	s.mutex.RUnlock()
+
+	for _, entry := range entries {
+		block, err := LoadBlock(entry.File, s.dir)
+		if err != nil {
+			nextutils.Error("Error loading block %s: %v", entry.Hash, err)
+			continue
+		}
+		if err := fn(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package nxtblock
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// * ORPHAN BLOCK POOL * //
+// ? Blöcke, deren Vorgänger (noch) nicht bekannt ist, z.B. weil beim Sync die Blöcke in beliebiger
+// ? Reihenfolge ankommen. Sie werden nach dem Hash des Vorgängers abgelegt und erneut versucht,
+// ? sobald dieser übernommen wurde. Die Größe ist begrenzt, alte Einträge laufen ab.
+
+var ErrOrphanBlock = errors.New("orphan block, previous block not known yet")
+
+var MaxOrphanBlocks = 500
+var OrphanExpiry = 20 * time.Minute
+
+// ? Das Target eines Orphans lässt sich ohne Vorgänger nicht nachrechnen. Damit billig geminte
+// ? Blöcke den Pool nicht füllen, darf es höchstens um diesen Faktor über dem Target des
+// ? aktuellen Tips liegen (schwerere Blöcke sind immer erlaubt).
+const MaxOrphanTargetFactor = 16
+
+type orphanBlock struct {
+	block Block
+	added time.Time
+}
+
+var orphanMutex sync.Mutex
+var orphansByHash = make(map[string]orphanBlock)
+var orphansByParent = make(map[string][]string)
+
+// * ADD ORPHAN * //
+
+func addOrphanBlock(block Block) {
+	orphanMutex.Lock()
+	defer orphanMutex.Unlock()
+
+	if _, exists := orphansByHash[block.Hash]; exists {
+		return
+	}
+	expireOrphans(time.Now())
+	for len(orphansByHash) >= MaxOrphanBlocks && len(orphansByHash) > 0 {
+		removeOrphan(oldestOrphan())
+	}
+
+	orphansByHash[block.Hash] = orphanBlock{block: block, added: time.Now()}
+	orphansByParent[block.PreviousHash] = append(orphansByParent[block.PreviousHash], block.Hash)
+}
+
+// * CHECK ORPHAN BITS * //
+
+func checkOrphanBits(block Block, tip Block, ruleset RuleSet) error {
+	bits := ruleset.Bits
+	if tip.Hash != "" {
+		bits = tip.Ruleset.Bits
+	}
+	tipTarget, err := CompactToTarget(bits)
+	if err != nil {
+		return fmt.Errorf("invalid tip target: %v", err)
+	}
+	target, err := CompactToTarget(block.Ruleset.Bits)
+	if err != nil {
+		return fmt.Errorf("invalid target: %v", err)
+	}
+	if limit := new(big.Int).Mul(tipTarget, big.NewInt(MaxOrphanTargetFactor)); target.Cmp(limit) > 0 {
+		return fmt.Errorf("target %08x is more than %d times easier than the tip target %08x", block.Ruleset.Bits, MaxOrphanTargetFactor, bits)
+	}
+	return nil
+}
+
+// * TAKE ORPHANS BY PARENT * //
+// ? Entfernt alle Orphans mit diesem Vorgänger aus dem Pool und gibt sie zurück
+
+func takeOrphanBlocks(parent string) []Block {
+	orphanMutex.Lock()
+	defer orphanMutex.Unlock()
+
+	var blocks []Block
+	for _, hash := range orphansByParent[parent] {
+		if orphan, exists := orphansByHash[hash]; exists {
+			blocks = append(blocks, orphan.block)
+			delete(orphansByHash, hash)
+		}
+	}
+	delete(orphansByParent, parent)
+	return blocks
+}
+
+// * ORPHAN COUNT * //
+
+func GetOrphanBlockCount() int {
+	orphanMutex.Lock()
+	defer orphanMutex.Unlock()
+	return len(orphansByHash)
+}
+
+// ? Die folgenden Funktionen setzen orphanMutex voraus
+
+func expireOrphans(now time.Time) {
+	for hash, orphan := range orphansByHash {
+		if now.Sub(orphan.added) > OrphanExpiry {
+			removeOrphan(hash)
+		}
+	}
+}
+
+func oldestOrphan() string {
+	var oldest string
+	var oldestAdded time.Time
+	for hash, orphan := range orphansByHash {
+		if oldest == "" || orphan.added.Before(oldestAdded) {
+			oldest = hash
+			oldestAdded = orphan.added
+		}
+	}
+	return oldest
+}
+
+func removeOrphan(hash string) {
+	orphan, exists := orphansByHash[hash]
+	if !exists {
+		return
+	}
+	delete(orphansByHash, hash)
+
+	siblings := orphansByParent[orphan.block.PreviousHash]
+	for i, sibling := range siblings {
+		if sibling == hash {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(orphansByParent, orphan.block.PreviousHash)
+	} else {
+		orphansByParent[orphan.block.PreviousHash] = siblings
+	}
+}
@@ -0,0 +1,159 @@
+package nxtblock
+
+import (
+	"errors"
+	"fmt"
+	"nxtchain/nextutils"
+	"nxtchain/nxtutxodb"
+	"strconv"
+	"strings"
+)
+
+// * PRUNING * //
+// ? Im Pruned-Modus (PruneDepth > 0) werden die Transaktionen von Blöcken der aktiven Kette
+// ? entfernt, sobald sie mehr als PruneDepth Blöcke unter dem Tip liegen und der Snapshot der
+// ? UTXO Datenbank sie abdeckt. Header (und damit Blockbaum und Arbeit) bleiben erhalten, die
+// ? Undo-Daten werden gelöscht. Reorgs tiefer als PruneDepth sind danach nicht mehr möglich.
+
+var PruneDepth = 0
+
+const MinPruneDepth = 100
+
+var ErrHistoryPruned = errors.New("history pruned")
+
+// ? Header eines Blocks: alle Felder außer den Transaktionen
+func blockHeader(block Block) Block {
+	block.Transactions = nil
+	block.HeadTransactions = nil
+	return block
+}
+
+// ? Jeder gültige Block hat eine Head-Transaktion, ohne ist nur noch der Header vorhanden
+func isBlockHeader(block Block) bool {
+	return len(block.HeadTransactions) == 0
+}
+
+// * PRUNE BLOCKS * //
+// ? Pruned alle Blöcke bis zur erlaubten Höhe und gibt die Anzahl zurück
+
+func PruneBlocks(dir string) (int, error) {
+	acceptMutex.Lock()
+	defer acceptMutex.Unlock()
+
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return 0, err
+	}
+	return pruneBlocks(dir, store)
+}
+
+// ? Setzt acceptMutex voraus
+func pruneBlocks(dir string, store BlockStore) (int, error) {
+	if PruneDepth <= 0 {
+		return 0, nil
+	}
+
+	tip := nxtutxodb.Tip()
+	if localTip, err := store.Tip(); err != nil || localTip.Hash != tip.Hash {
+		return 0, nil
+	}
+	limit := tip.Height - PruneDepth
+	// ? Blöcke nach dem Snapshot werden beim Prüfen des UTXO Journals noch gebraucht
+	if snapshot, _ := nxtutxodb.AppliedBlocks(); snapshot.Height < limit {
+		limit = snapshot.Height
+	}
+
+	// ? Geprunte Blöcke bilden den Anfang der aktiven Kette, also von oben bis zum ersten
+	// ? bereits geprunten Block
+	pruned := 0
+	for height := limit; height >= 0; height-- {
+		block, err := store.GetByHeight(height)
+		if err != nil || store.Pruned(block.Hash) {
+			break
+		}
+		if err := store.Prune(block.Hash); err != nil {
+			return pruned, fmt.Errorf("error pruning block %s: %v", block.Hash, err)
+		}
+		if err := DeleteBlockUndo(block.Hash, dir); err != nil {
+			nextutils.Error("Error removing undo data of block %s: %v", block.Hash, err)
+		}
+		pruned++
+	}
+	if pruned > 0 {
+		nextutils.Debug("Pruned %d blocks up to height %d", pruned, limit)
+	}
+	return pruned, nil
+}
+
+// * PRUNED HEIGHT * //
+// ? Höchste Höhe der aktiven Kette, deren Block gepruned ist (0 = nichts gepruned). Da die
+// ? geprunten Blöcke den Anfang der Kette bilden, reicht eine binäre Suche.
+
+func GetPrunedHeight(dir string) int {
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return 0
+	}
+	return prunedHeight(store)
+}
+
+func prunedHeight(store BlockStore) int {
+	pruned := func(height int) bool {
+		block, err := store.GetByHeight(height)
+		return err == nil && store.Pruned(block.Hash)
+	}
+
+	prunedHeight := 0
+	low, high := 1, store.Height()
+	for low <= high {
+		middle := (low + high) / 2
+		if pruned(middle) {
+			prunedHeight = middle
+			low = middle + 1
+		} else {
+			high = middle - 1
+		}
+	}
+	return prunedHeight
+}
+
+// * CHECK FULL HISTORY * //
+// ? Indizes über die ganze Kette (RebuildTxIndex, RebuildAddrIndex) lassen sich nur aus
+// ? vollständigen Blöcken aufbauen
+
+func checkFullHistory(store BlockStore) error {
+	if height := prunedHeight(store); height > 0 {
+		return fmt.Errorf("%w below height %d", ErrHistoryPruned, height+1)
+	}
+	return nil
+}
+
+// * IS BLOCK PRUNED * //
+
+func IsBlockPruned(dir string, hash string) bool {
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return false
+	}
+	return store.Pruned(hash)
+}
+
+// * PRUNED HANDSHAKE * //
+// ? Im Peer-Handshake (gonetic HELLO_) meldet ein Node, bis zu welcher Höhe er keine Blöcke mehr
+// ? ausliefert: PRUNED_<höhe> bei Pruned Nodes, sonst FULL
+
+func PrunedHandshake(dir string) string {
+	if prunedHeight := GetPrunedHeight(dir); prunedHeight > 0 {
+		return "PRUNED_" + strconv.Itoa(prunedHeight)
+	}
+	return "FULL"
+}
+
+// ? Gepruned bis zur zurückgegebenen Höhe, 0 bei Full Nodes (oder unbekanntem Handshake)
+func ParsePrunedHandshake(data string) int {
+	height, err := strconv.Atoi(strings.TrimPrefix(data, "PRUNED_"))
+	if !strings.HasPrefix(data, "PRUNED_") || err != nil || height < 0 {
+		return 0
+	}
+	return height
+}
@@ -0,0 +1,170 @@
+package nxtblock
+
+import (
+	"fmt"
+	"nxtchain/nextutils"
+	"nxtchain/nxtutxodb"
+)
+
+// * REINDEX RESULT * //
+
+type ReindexResult struct {
+	Blocks        int                // Anzahl gültiger Blöcke
+	Tip           nxtutxodb.BlockRef // Letzter gültiger Block
+	Commitment    string             // Commitment-Hash des neu aufgebauten UTXO Sets
+	InvalidHash   string             // Erster ungültiger Block ("" wenn die Kette gültig ist)
+	InvalidHeight int
+	InvalidError  error
+}
+
+// * MAIN CHAIN * //
+// ? Geht vom lokalen Tip über PreviousHash zurück bis GENESIS und gibt die Hashes aufsteigend zurück.
+// ? Fehlt ein Vorgänger, beginnt die Liste beim ersten Block nach der Lücke und missing ist gesetzt.
+
+func mainChain(store BlockStore) (hashes []string, missing string) {
+	tip, err := store.Tip()
+	if err != nil {
+		return nil, ""
+	}
+
+	block := tip
+	for {
+		hashes = append(hashes, block.Hash)
+		if block.PreviousHash == "GENESIS" {
+			break
+		}
+		previous, err := store.Get(block.PreviousHash)
+		if err != nil {
+			missing = block.PreviousHash
+			break
+		}
+		block = previous
+	}
+
+	for i, j := 0, len(hashes)-1; i < j; i, j = i+1, j-1 {
+		hashes[i], hashes[j] = hashes[j], hashes[i]
+	}
+	return hashes, missing
+}
+
+// * REINDEX CHAIN * //
+// ? Baut das UTXO Set aus den lokalen Blöcken in einem privaten Set neu auf. Jeder Block wird in
+// ? Höhenreihenfolge voll validiert, beim ersten ungültigen Block wird abgebrochen. Das Set
+// ? enthält danach den Stand nach dem letzten gültigen Block. Die UTXO Datenbank wird dabei weder
+// ? gelesen noch verändert, Node und Miner können währenddessen weiterlaufen.
+
+func ReindexChain(dir string, ruleset RuleSet) (ReindexResult, map[string]nxtutxodb.UTXO, error) {
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return ReindexResult{}, nil, err
+	}
+	hashes, missing := mainChain(store)
+	return replayChain(dir, store, hashes, missing, ruleset, false)
+}
+
+func replayChain(dir string, store BlockStore, hashes []string, missing string, ruleset RuleSet, writeUndo bool) (ReindexResult, map[string]nxtutxodb.UTXO, error) {
+	var result ReindexResult
+	for _, hash := range hashes {
+		if store.Pruned(hash) {
+			return result, nil, fmt.Errorf("block %s is pruned, reindexing needs all blocks", hash)
+		}
+	}
+
+	utxos := make(map[string]nxtutxodb.UTXO)
+
+	for i, hash := range hashes {
+		block, err := store.Get(hash)
+		if err != nil {
+			return result, nil, fmt.Errorf("error loading block %s: %v", hash, err)
+		}
+
+		if i == 0 && missing != "" {
+			result.InvalidHash = block.Hash
+			result.InvalidHeight = block.BlockHeight
+			result.InvalidError = fmt.Errorf("previous block %s not found locally", missing)
+			break
+		}
+
+		// ? Undo-Daten aus dem Stand vor dem Block, danach validieren (die Sicht ändert utxos nicht)
+		undo, err := createBlockUndo(block, nxtutxodb.NewMapView(utxos))
+		view := nxtutxodb.NewMapView(utxos)
+		if err == nil {
+			var valid bool
+			valid, err = validateBlock(block, dir, ruleset, view)
+			if err == nil && !valid {
+				err = fmt.Errorf("invalid block %s", block.Hash)
+			}
+		}
+		if err != nil {
+			result.InvalidHash = block.Hash
+			result.InvalidHeight = block.BlockHeight
+			result.InvalidError = err
+			break
+		}
+
+		if writeUndo {
+			if err := SaveBlockUndo(undo, dir); err != nil {
+				return result, nil, fmt.Errorf("error saving undo data for block %s: %v", block.Hash, err)
+			}
+		}
+		view.ApplyTo(utxos)
+		result.Blocks++
+		result.Tip = nxtutxodb.BlockRef{Hash: block.Hash, Height: block.BlockHeight}
+
+		if result.Blocks%1000 == 0 {
+			nextutils.Debug("Reindex: %d blocks processed (height %d)", result.Blocks, block.BlockHeight)
+		}
+	}
+
+	result.Commitment = nxtutxodb.CommitmentHash(utxos)
+	return result, utxos, nil
+}
+
+// * REINDEX (persistent) * //
+// ? Ersetzt die UTXO Datenbank durch das aus den Blöcken aufgebaute Set (Stand nach dem letzten
+// ? gültigen Block) und schreibt die Undo-Daten aller gültigen Blöcke neu. Hält acceptMutex, damit
+// ? währenddessen kein Block angenommen wird.
+
+func Reindex(dir string, ruleset RuleSet) (ReindexResult, error) {
+	acceptMutex.Lock()
+	defer acceptMutex.Unlock()
+
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return ReindexResult{}, err
+	}
+	hashes, missing := mainChain(store)
+	result, utxos, err := replayChain(dir, store, hashes, missing, ruleset, true)
+	if err != nil {
+		return result, err
+	}
+	if err := nxtutxodb.Replace(utxos, nxtutxodb.SourceBlocks, result.Tip); err != nil {
+		return result, fmt.Errorf("error persisting utxo database: %v", err)
+	}
+	return result, nil
+}
+
+// * VERIFY CHAIN * //
+// ? Wie ReindexChain, die bestehende UTXO Datenbank bleibt unverändert. Zusätzlich wird
+// ? zurückgegeben, ob das neu aufgebaute Set mit der Datenbank übereinstimmt. Kette, Tip und
+// ? Commitment der Datenbank werden zusammen unter acceptMutex gelesen, die Prüfung selbst läuft
+// ? ohne Lock.
+
+func VerifyChain(dir string, ruleset RuleSet) (ReindexResult, bool, error) {
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return ReindexResult{}, false, err
+	}
+
+	acceptMutex.Lock()
+	hashes, missing := mainChain(store)
+	previousTip := nxtutxodb.Tip()
+	previousCommitment := nxtutxodb.Commitment()
+	acceptMutex.Unlock()
+
+	result, _, err := replayChain(dir, store, hashes, missing, ruleset, false)
+	if err != nil {
+		return result, false, err
+	}
+	return result, result.Commitment == previousCommitment && result.Tip == previousTip, nil
+}
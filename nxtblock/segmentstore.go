@@ -0,0 +1,502 @@
+package nxtblock
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/big"
+	"nxtchain/nextutils"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// * SEGMENT BLOCK STORE * //
+// ? Append-only Segmentdateien (<block_dir>/blk00000.dat, ...). Jeder Record besteht aus
+// ? [4 Byte Länge][4 Byte CRC32][Block (binär kodiert)], der Index zeigt auf Segment + Offset.
+// ? Gelöschte Blöcke werden nur aus dem Index entfernt. Beim Prunen wird der Header neu
+// ? angehängt, ein Segment ohne verwendete Records wird gelöscht.
+
+const segmentPrefix = "blk"
+const segmentSuffix = ".dat"
+const segmentHeaderSize = 8
+const maxSegmentSize int64 = 128 * 1024 * 1024
+
+type segmentBlockStore struct {
+	dir     string
+	mutex   sync.RWMutex
+	index   *blockIndex
+	segment int
+	size    int64
+}
+
+func openSegmentBlockStore(dir string) (*segmentBlockStore, error) {
+	store := &segmentBlockStore{dir: dir, index: newBlockIndex(dir)}
+
+	loaded, err := store.index.load()
+	if err != nil {
+		nextutils.Error("Error loading block index, rebuilding: %v", err)
+	}
+	if !loaded {
+		if err := store.Rebuild(); err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+
+	if err := store.recover(); err != nil {
+		nextutils.Error("Block index out of date, rebuilding: %v", err)
+		if err := store.Rebuild(); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+func segmentName(segment int) string {
+	return fmt.Sprintf("%s%05d%s", segmentPrefix, segment, segmentSuffix)
+}
+
+func segmentFiles(dir string) ([]int, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []int
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		number, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix))
+		if err != nil {
+			continue
+		}
+		segments = append(segments, number)
+	}
+	sort.Ints(segments)
+	return segments, nil
+}
+
+func (s *segmentBlockStore) segmentPath(segment int) string {
+	return filepath.Join(s.dir, segmentName(segment))
+}
+
+// * RECOVER * //
+// ? Gleicht den Index mit den Segmentdateien ab: Records hinter dem letzten indexierten
+// ? Eintrag werden nachgetragen, ein abgeschnittener letzter Record wird entfernt.
+
+func (s *segmentBlockStore) recover() error {
+	indexedEnd := make(map[int]int64)
+	for _, entry := range s.index.byHash {
+		end := entry.Offset + segmentHeaderSize + int64(entry.Length)
+		if end > indexedEnd[entry.Segment] {
+			indexedEnd[entry.Segment] = end
+		}
+	}
+
+	segments, err := segmentFiles(s.dir)
+	if err != nil {
+		return err
+	}
+	present := make(map[int]bool)
+	for _, segment := range segments {
+		present[segment] = true
+	}
+	for segment := range indexedEnd {
+		if !present[segment] {
+			return fmt.Errorf("indexed segment %s is missing", segmentName(segment))
+		}
+	}
+	for _, segment := range segments {
+		info, err := os.Stat(s.segmentPath(segment))
+		if err != nil {
+			return err
+		}
+		from := indexedEnd[segment]
+		if info.Size() < from {
+			return fmt.Errorf("segment %s is shorter than indexed (%d < %d)", segmentName(segment), info.Size(), from)
+		}
+		if info.Size() == from {
+			continue
+		}
+		end, err := s.scanSegment(segment, from, func(entry blockIndexEntry, block Block) error {
+			if _, exists := s.index.byHash[entry.Hash]; exists {
+				return nil
+			}
+			return s.index.append(entry)
+		})
+		if err != nil {
+			return err
+		}
+		if end < info.Size() {
+			nextutils.Error("Truncating damaged tail of %s at offset %d", segmentName(segment), end)
+			if err := os.Truncate(s.segmentPath(segment), end); err != nil {
+				return err
+			}
+		}
+	}
+	return s.openTail(segments)
+}
+
+func (s *segmentBlockStore) openTail(segments []int) error {
+	s.segment = 0
+	s.size = 0
+	if len(segments) == 0 {
+		return nil
+	}
+	s.segment = segments[len(segments)-1]
+	info, err := os.Stat(s.segmentPath(s.segment))
+	if err != nil {
+		return err
+	}
+	s.size = info.Size()
+	return nil
+}
+
+// * SCAN SEGMENT * //
+// ? Liest alle gültigen Records ab from und gibt das Ende des letzten gültigen Records zurück
+
+func (s *segmentBlockStore) scanSegment(segment int, from int64, fn func(entry blockIndexEntry, block Block) error) (int64, error) {
+	file, err := os.Open(s.segmentPath(segment))
+	if err != nil {
+		return from, err
+	}
+	defer file.Close()
+
+	offset := from
+	for {
+		payload, err := readSegmentRecord(file, offset)
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			nextutils.Error("Invalid record in %s at offset %d: %v", segmentName(segment), offset, err)
+			return offset, nil
+		}
+		block, err := decodeStoredBlock(payload)
+		if err != nil {
+			nextutils.Error("Invalid block in %s at offset %d: %v", segmentName(segment), offset, err)
+			return offset, nil
+		}
+		entry := newIndexEntry(block)
+		entry.Segment, entry.Offset, entry.Length = segment, offset, len(payload)
+		if err := fn(entry, block); err != nil {
+			return offset, err
+		}
+		offset += segmentHeaderSize + int64(len(payload))
+	}
+}
+
+func encodeSegmentRecord(payload []byte) []byte {
+	record := make([]byte, segmentHeaderSize, segmentHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	return append(record, payload...)
+}
+
+func readSegmentRecord(file *os.File, offset int64) ([]byte, error) {
+	header := make([]byte, segmentHeaderSize)
+	n, err := file.ReadAt(header, offset)
+	if n == 0 && err == io.EOF {
+		return nil, io.EOF
+	}
+	if n < segmentHeaderSize {
+		return nil, fmt.Errorf("truncated record header")
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+
+	// ? Die Länge erst gegen die restliche Datei prüfen, sonst reserviert ein beschädigtes
+	// ? Längenfeld bis zu 4 GB, bevor die Prüfsumme den Fehler zeigt. Archive (ImportChain)
+	// ? kommen von anderen, daher zusätzlich keine Records größer als ein Segment.
+	if int64(length) > maxSegmentSize {
+		return nil, fmt.Errorf("record too large: %d > %d bytes", length, maxSegmentSize)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if int64(length) > info.Size()-offset-segmentHeaderSize {
+		return nil, fmt.Errorf("truncated record payload")
+	}
+
+	payload := make([]byte, length)
+	if n, _ := file.ReadAt(payload, offset+segmentHeaderSize); n < int(length) {
+		return nil, fmt.Errorf("truncated record payload")
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, fmt.Errorf("record checksum mismatch")
+	}
+	return payload, nil
+}
+
+// * REBUILD INDEX * //
+
+func (s *segmentBlockStore) Rebuild() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	segments, err := segmentFiles(s.dir)
+	if err != nil {
+		return err
+	}
+
+	var entries []blockIndexEntry
+	for _, segment := range segments {
+		_, err := s.scanSegment(segment, 0, func(entry blockIndexEntry, block Block) error {
+			entries = append(entries, entry)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := s.index.rewrite(entries); err != nil {
+		return err
+	}
+	nextutils.Debug("Block index rebuilt: %d blocks in %d segments, tip %s", len(s.index.byHash), len(segments), s.index.tip)
+	return s.openTail(segments)
+}
+
+// * PUT BLOCK * //
+
+func (s *segmentBlockStore) Put(block Block) (string, error) {
+	payload := EncodeBlock(block)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if entry, exists := s.index.byHash[block.Hash]; exists {
+		return s.segmentPath(entry.Segment), nil
+	}
+
+	entry := newIndexEntry(block)
+	if err := s.appendRecord(payload, &entry); err != nil {
+		return "", err
+	}
+	if err := s.index.append(entry); err != nil {
+		return "", fmt.Errorf("error updating block index: %v", err)
+	}
+	return s.segmentPath(entry.Segment), nil
+}
+
+// ? Hängt einen Record an das aktuelle Segment an und setzt Segment/Offset/Length des Eintrags.
+// ? Setzt s.mutex voraus.
+func (s *segmentBlockStore) appendRecord(payload []byte, entry *blockIndexEntry) error {
+	record := encodeSegmentRecord(payload)
+	recordSize := int64(len(record))
+	if s.size > 0 && s.size+recordSize > maxSegmentSize {
+		s.segment++
+		s.size = 0
+	}
+
+	file, err := os.OpenFile(s.segmentPath(s.segment), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening segment: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(record); err != nil {
+		return fmt.Errorf("error writing block record: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("error syncing segment: %v", err)
+	}
+
+	entry.Segment, entry.Offset, entry.Length = s.segment, s.size, len(payload)
+	s.size += recordSize
+	return nil
+}
+
+// * PRUNE BLOCK * //
+// ? Hängt den Header des Blocks neu an und lässt den Index darauf zeigen. Wird ein älteres
+// ? Segment dadurch nicht mehr verwendet, wird es gelöscht.
+
+func (s *segmentBlockStore) Prune(hash string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old, exists := s.index.byHash[hash]
+	if !exists {
+		return os.ErrNotExist
+	}
+	if old.Pruned {
+		return nil
+	}
+	block, err := s.read(old)
+	if err != nil {
+		return err
+	}
+	payload := EncodeBlock(blockHeader(block))
+
+	entry := blockIndexEntry{Op: "prune", Hash: hash}
+	if err := s.appendRecord(payload, &entry); err != nil {
+		return err
+	}
+	if err := s.index.append(entry); err != nil {
+		return fmt.Errorf("error updating block index: %v", err)
+	}
+
+	if old.Segment != s.segment && s.index.segments[old.Segment] <= 0 {
+		if err := os.Remove(s.segmentPath(old.Segment)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing pruned segment: %v", err)
+		}
+		delete(s.index.segments, old.Segment)
+		nextutils.Debug("Removed fully pruned segment %s", segmentName(old.Segment))
+	}
+	return nil
+}
+
+// * PRUNED * //
+
+func (s *segmentBlockStore) Pruned(hash string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.index.byHash[hash].Pruned
+}
+
+// * DELETE BLOCK * //
+
+func (s *segmentBlockStore) Delete(hash string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.index.byHash[hash]; !exists {
+		return os.ErrNotExist
+	}
+	if err := s.index.append(blockIndexEntry{Op: "delete", Hash: hash}); err != nil {
+		return fmt.Errorf("error updating block index: %v", err)
+	}
+	return nil
+}
+
+// * READ BLOCK * //
+
+func (s *segmentBlockStore) read(entry blockIndexEntry) (Block, error) {
+	file, err := os.Open(s.segmentPath(entry.Segment))
+	if err != nil {
+		return Block{}, err
+	}
+	defer file.Close()
+
+	payload, err := readSegmentRecord(file, entry.Offset)
+	if err != nil {
+		return Block{}, err
+	}
+	return decodeStoredBlock(payload)
+}
+
+// * GET BLOCK BY HASH * //
+
+func (s *segmentBlockStore) Get(hash string) (Block, error) {
+	s.mutex.RLock()
+	entry, exists := s.index.byHash[hash]
+	s.mutex.RUnlock()
+	if !exists {
+		return Block{}, os.ErrNotExist
+	}
+	return s.read(entry)
+}
+
+// * GET BLOCK BY HEIGHT * //
+
+func (s *segmentBlockStore) GetByHeight(height int) (Block, error) {
+	s.mutex.RLock()
+	hash, exists := s.index.byHeight[height]
+	s.mutex.RUnlock()
+	if !exists {
+		return Block{}, os.ErrNotExist
+	}
+	return s.Get(hash)
+}
+
+// * HAS BLOCK * //
+
+func (s *segmentBlockStore) Has(hash string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	_, exists := s.index.byHash[hash]
+	return exists
+}
+
+// * TIP * //
+
+func (s *segmentBlockStore) Tip() (Block, error) {
+	s.mutex.RLock()
+	tip := s.index.tip
+	s.mutex.RUnlock()
+	if tip == "" {
+		return Block{}, os.ErrNotExist
+	}
+	return s.Get(tip)
+}
+
+// * SET TIP (aktive Kette umstellen) * //
+
+func (s *segmentBlockStore) SetTip(hash string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.index.byHash[hash]; !exists && hash != "" {
+		return os.ErrNotExist
+	}
+	if s.index.tip == hash {
+		return nil
+	}
+	if err := s.index.append(blockIndexEntry{Op: "tip", Hash: hash}); err != nil {
+		return fmt.Errorf("error updating block index: %v", err)
+	}
+	return nil
+}
+
+// * CHAIN WORK * //
+
+func (s *segmentBlockStore) ChainWork(hash string) (*big.Int, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	work, exists := s.index.chainWork[hash]
+	if !exists {
+		return nil, false
+	}
+	return new(big.Int).Set(work), true
+}
+
+// * HEIGHT * //
+
+func (s *segmentBlockStore) Height() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.index.height()
+}
+
+// * COUNT * //
+
+func (s *segmentBlockStore) Count() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.index.byHeight)
+}
+
+// * ITERATE (aufsteigend nach Höhe) * //
+
+func (s *segmentBlockStore) Iterate(fn func(block Block) error) error {
+	s.mutex.RLock()
+	entries := s.index.sorted()
+	s.mutex.RUnlock()
+
+	for _, entry := range entries {
+		block, err := s.read(entry)
+		if err != nil {
+			nextutils.Error("Error loading block %s: %v", entry.Hash, err)
+			continue
+		}
+		if err := fn(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
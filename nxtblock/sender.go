@@ -1,76 +1,107 @@
 package nxtblock
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"nxtchain/nxtutxodb"
+	"strings"
 )
 
+// ? Über das Netzwerk gehen Blöcke, Transaktionen und UTXO Sets binär kodiert (encoding.go)
+// ? als base64, damit die Nachrichten Text bleiben und kein "_" enthalten. Nachrichten älterer
+// ? Versionen sind JSON und werden weiter angenommen.
+
+func isJSONMessage(message string) bool {
+	return strings.HasPrefix(strings.TrimSpace(message), "{")
+}
+
 // * PREPARE TRANSACTION SENDER * //
 
 func PrepareTransactionSender(transaction Transaction) (string, error) {
-	jsonData, err := json.Marshal(transaction)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal transaction: %v", err)
-	}
-
-	return string(jsonData), nil
+	return base64.StdEncoding.EncodeToString(EncodeTransaction(transaction)), nil
 }
 
 // * GET TRANSACTION SENDER * //
 
 func GetTransactionSender(transactionStr string) (Transaction, error) {
 	var transaction Transaction
-	err := json.Unmarshal([]byte(transactionStr), &transaction)
-	if err != nil {
-		return transaction, fmt.Errorf("failed to unmarshal transaction: %v", err)
+	if isJSONMessage(transactionStr) {
+		err := json.Unmarshal([]byte(transactionStr), &transaction)
+		if err != nil {
+			return transaction, fmt.Errorf("failed to unmarshal transaction: %v", err)
+		}
+		return transaction, nil
 	}
 
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(transactionStr))
+	if err != nil {
+		return transaction, fmt.Errorf("failed to decode transaction: %v", err)
+	}
+	transaction, err = DecodeTransaction(data)
+	if err != nil {
+		return transaction, fmt.Errorf("failed to decode transaction: %v", err)
+	}
 	return transaction, nil
 }
 
 // * PREPARE BLOCK SENDER * //
 
 func PrepareBlockSender(block Block) (string, error) {
-	jsonData, err := json.Marshal(block)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal block: %v", err)
-	}
-
-	return string(jsonData), nil
+	return base64.StdEncoding.EncodeToString(EncodeBlock(block)), nil
 }
 
 // * GET BLOCK SENDER * //
 
 func GetBlockSender(blockStr string) (Block, error) {
 	var block Block
-	err := json.Unmarshal([]byte(blockStr), &block)
-	if err != nil {
-		return block, fmt.Errorf("failed to unmarshal block: %v", err)
+	if isJSONMessage(blockStr) {
+		err := json.Unmarshal([]byte(blockStr), &block)
+		if err != nil {
+			return block, fmt.Errorf("failed to unmarshal block: %v", err)
+		}
+		return block, nil
 	}
 
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(blockStr))
+	if err != nil {
+		return block, fmt.Errorf("failed to decode block: %v", err)
+	}
+	block, err = DecodeBlock(data)
+	if err != nil {
+		return block, fmt.Errorf("failed to decode block: %v", err)
+	}
 	return block, nil
 }
 
 // * PREPARE UTXO SENDER * //
 
 func PrepareUTXOSender(utxo map[string]nxtutxodb.UTXO) (string, error) {
-	jsonData, err := json.Marshal(utxo)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal utxo: %v", err)
-	}
-
-	return string(jsonData), nil
+	return base64.StdEncoding.EncodeToString(nxtutxodb.EncodeUTXOMap(utxo)), nil
 }
 
 // * GET UTXO SENDER * //
 
 func GetUTXOSender(utxoStr string) (map[string]nxtutxodb.UTXO, error) {
 	utxo := make(map[string]nxtutxodb.UTXO)
-	err := json.Unmarshal([]byte(utxoStr), &utxo)
-	if err != nil {
-		return utxo, fmt.Errorf("failed to unmarshal utxo: %v", err)
+	if isJSONMessage(utxoStr) {
+		err := json.Unmarshal([]byte(utxoStr), &utxo)
+		if err != nil {
+			return utxo, fmt.Errorf("failed to unmarshal utxo: %v", err)
+		}
+		if err := nxtutxodb.CheckUTXOKeys(utxo); err != nil {
+			return utxo, fmt.Errorf("failed to unmarshal utxo: %v", err)
+		}
+		return utxo, nil
 	}
 
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(utxoStr))
+	if err != nil {
+		return utxo, fmt.Errorf("failed to decode utxo: %v", err)
+	}
+	utxo, err = nxtutxodb.DecodeUTXOMap(data)
+	if err != nil {
+		return utxo, fmt.Errorf("failed to decode utxo: %v", err)
+	}
 	return utxo, nil
 }
@@ -0,0 +1,66 @@
+package nxtblock
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"nxtchain/nextutils"
+)
+
+// * SIGNATURE HASH * //
+// ? Deterministischer Digest, den jeder Input signiert (Transaction.Hash). Er wird aus den
+// ? kodierten Feldern der Transaktion ohne Signaturen gebildet:
+// ? Tag | Timestamp | Inputs (Txid, Index, PublicKey) | Outputs (Index, Amount, ReceiverAddr)
+// ? Der Validator rechnet ihn nach, eine nach dem Signieren veränderte Transaktion ist damit
+// ? ungültig.
+// ?
+// * TRANSACTION ID * //
+// ? Die Txid ist der Hash über den Signatur-Digest und alle Signaturen, also über den gesamten
+// ? Inhalt der Transaktion (keine Zufalls-ID mehr).
+
+const sigHashTag = "NXT-SIGHASH-1"
+const txidTag = "NXT-TXID-1"
+
+// * CALCULATE SIGNATURE HASH * //
+
+func CalculateSigHash(transaction Transaction) string {
+	var e nextutils.Encoder
+	e.PutString(sigHashTag)
+	e.PutVarint(transaction.Timestamp)
+	e.PutUvarint(uint64(len(transaction.Inputs)))
+	for _, input := range transaction.Inputs {
+		e.PutString(input.Txid)
+		e.PutVarint(int64(input.Index))
+		e.PutBytes(input.PublicKey)
+	}
+	e.PutUvarint(uint64(len(transaction.Outputs)))
+	for _, output := range transaction.Outputs {
+		writeTOutput(&e, output)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(e.Bytes()))
+}
+
+// * CALCULATE TRANSACTION ID * //
+
+func CalculateTransactionID(transaction Transaction) string {
+	var e nextutils.Encoder
+	e.PutString(txidTag)
+	e.PutString(CalculateSigHash(transaction))
+	e.PutUvarint(uint64(len(transaction.Inputs)))
+	for _, input := range transaction.Inputs {
+		e.PutBytes(input.Signature)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(e.Bytes()))
+}
+
+// * CHECK TRANSACTION HASHES * //
+// ? Hash und ID müssen dem Inhalt der Transaktion entsprechen
+
+func CheckTransactionHashes(transaction Transaction) error {
+	if sigHash := CalculateSigHash(transaction); transaction.Hash != sigHash {
+		return fmt.Errorf("transaction hash mismatch: got %s, want %s", transaction.Hash, sigHash)
+	}
+	if id := CalculateTransactionID(transaction); transaction.ID != id {
+		return fmt.Errorf("transaction ID mismatch: got %s, want %s", transaction.ID, id)
+	}
+	return nil
+}
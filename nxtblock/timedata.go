@@ -0,0 +1,128 @@
+package nxtblock
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// * BLOCK TIME RULES * //
+// ? Ein Block muss später sein als der Median der letzten MedianTimeSpan Blöcke (Median Time Past)
+// ? und darf höchstens MaxFutureBlockTime vor der Netzwerkzeit liegen. Die Netzwerkzeit ist die
+// ? lokale Zeit plus Median der Uhrabweichungen der Peers (RESPONSE_TIME), damit eine leicht
+// ? falsch gehende lokale Uhr ehrliche Blöcke nicht ablehnt.
+
+const MedianTimeSpan = 11
+const MaxFutureBlockTime int64 = 2 * 60 * 60
+
+const MinTimeSamples = 5            // Peers, ab denen die Netzwerkzeit gilt
+const MaxTimeOffset int64 = 70 * 60 // Größere Abweichungen werden ignoriert (lokale Uhr prüfen)
+const maxTimeSamples = 200
+
+var timeOffsets = make(map[string]int64)
+var timeOffsetsMutex sync.Mutex
+
+// * ADD TIME SAMPLE * //
+// ? peerTime ist die von source gemeldete Unix-Zeit, gespeichert wird eine Abweichung pro
+// ? Verbindung. source muss die Transport-Identität der Verbindung sein (gonetic peerID), nicht
+// ? die im Text der Nachricht genannte Adresse, sonst könnte ein Peer beliebig viele Samples
+// ? abgeben. Beim Trennen der Verbindung wird das Sample mit RemoveTimeSample entfernt.
+
+func AddTimeSample(source string, peerTime int64) {
+	timeOffsetsMutex.Lock()
+	defer timeOffsetsMutex.Unlock()
+
+	if _, exists := timeOffsets[source]; !exists && len(timeOffsets) >= maxTimeSamples {
+		return
+	}
+	timeOffsets[source] = peerTime - GetTimestamp()
+}
+
+// * REMOVE TIME SAMPLE * //
+
+func RemoveTimeSample(source string) {
+	timeOffsetsMutex.Lock()
+	defer timeOffsetsMutex.Unlock()
+
+	delete(timeOffsets, source)
+}
+
+// * TIME OFFSET * //
+// ? Median der Abweichungen (die lokale Uhr zählt als Abweichung 0)
+
+func GetTimeOffset() int64 {
+	timeOffsetsMutex.Lock()
+	defer timeOffsetsMutex.Unlock()
+
+	if len(timeOffsets) < MinTimeSamples {
+		return 0
+	}
+	offsets := []int64{0}
+	for _, offset := range timeOffsets {
+		offsets = append(offsets, offset)
+	}
+	offset := medianInt64(offsets)
+	if offset > MaxTimeOffset || offset < -MaxTimeOffset {
+		return 0
+	}
+	return offset
+}
+
+// * ADJUSTED TIME * //
+
+func GetAdjustedTime() int64 {
+	return GetTimestamp() + GetTimeOffset()
+}
+
+// * MEDIAN TIME PAST * //
+// ? Median der Zeitstempel von parent und seinen Vorgängern (bis zu MedianTimeSpan Blöcke)
+
+func GetMedianTimePast(dir string, parent Block) (int64, error) {
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return 0, err
+	}
+	return medianTimePast(store, parent)
+}
+
+func medianTimePast(store BlockStore, parent Block) (int64, error) {
+	if parent.Hash == "" || parent.Hash == "GENESIS" {
+		return 0, nil
+	}
+	timestamps := []int64{parent.Timestamp}
+	block := parent
+	for len(timestamps) < MedianTimeSpan && block.PreviousHash != "GENESIS" {
+		previous, err := store.Get(block.PreviousHash)
+		if err != nil {
+			return 0, fmt.Errorf("block %s needed for median time not found: %v", block.PreviousHash, err)
+		}
+		timestamps = append(timestamps, previous.Timestamp)
+		block = previous
+	}
+	return medianInt64(timestamps), nil
+}
+
+func medianInt64(values []int64) int64 {
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	return values[len(values)/2]
+}
+
+// * CHECK BLOCK TIME * //
+
+func checkBlockFutureTime(block Block) error {
+	if limit := GetAdjustedTime() + MaxFutureBlockTime; block.Timestamp > limit {
+		return fmt.Errorf("block timestamp %d is too far in the future (limit %d)", block.Timestamp, limit)
+	}
+	return nil
+}
+
+func checkBlockMedianTime(store BlockStore, block Block, parent Block) error {
+	median, err := medianTimePast(store, parent)
+	if err != nil {
+		return err
+	}
+	if block.Timestamp <= median {
+		return fmt.Errorf("block timestamp %d is not after the median time past %d", block.Timestamp, median)
+	}
+	return nil
+}
@@ -1,34 +1,100 @@
 package nxtblock
 
+import (
+	"nxtchain/nextutils"
+	"sync"
+)
+
 var TransactionPool = make(map[string]Transaction)
+var poolMutex sync.Mutex
 
 // * ADD TRANSACTION TO TRANSACTION POOL * //
 
 func AddTransactionToPool(transaction Transaction) {
+	poolMutex.Lock()
+	defer poolMutex.Unlock()
+
 	TransactionPool[transaction.Hash] = transaction
 }
 
 // * REMOVE TRANSACTION FROM TRANSACTION POOL * //
 
 func RemoveTransactionFromPool(transaction Transaction) {
+	poolMutex.Lock()
+	defer poolMutex.Unlock()
+
 	delete(TransactionPool, transaction.Hash)
 }
 
 // * GET TRANSACTION FROM TRANSACTION POOL * //
 
 func GetTransactionFromPool(hash string) (Transaction, bool) {
+	poolMutex.Lock()
+	defer poolMutex.Unlock()
+
 	transaction, exists := TransactionPool[hash]
 	return transaction, exists
 }
 
 // * GET ALL TRANSACTIONS FROM TRANSACTION POOL * //
+// ? Gibt eine Kopie zurück, der Pool kann sich währenddessen ändern
 
 func GetAllTransactionsFromPool() map[string]Transaction {
-	return TransactionPool
+	poolMutex.Lock()
+	defer poolMutex.Unlock()
+
+	transactions := make(map[string]Transaction, len(TransactionPool))
+	for hash, transaction := range TransactionPool {
+		transactions[hash] = transaction
+	}
+	return transactions
 }
 
 // * GET TRANSACTION POOL SIZE * //
 
 func GetTransactionPoolSize() int {
+	poolMutex.Lock()
+	defer poolMutex.Unlock()
+
 	return len(TransactionPool)
 }
+
+// * RETURN TRANSACTIONS TO POOL * //
+// ? Transaktionen getrennter Blöcke (Reorg, InvalidateTip) kommen nur zurück in den Pool, wenn
+// ? sie auf dem neuen Tip noch gültig sind und die Mindest-Relaygebühr zahlen. Setzt voraus,
+// ? dass das UTXO Set schon den neuen Tip zeigt. Gibt die Anzahl übernommener Transaktionen zurück.
+
+func returnTransactionsToPool(blocks []Block, ruleset RuleSet) int {
+	returned := 0
+	for _, block := range blocks {
+		for _, transaction := range block.Transactions {
+			if valid, err := ValidatorValidateTransaction(transaction, ruleset); !valid || err != nil {
+				nextutils.Debug("Transaction %s of disconnected block %s dropped: %v", transaction.ID, block.Hash, err)
+				continue
+			}
+			if err := CheckRelayFee(transaction, MinRelayFeeRate); err != nil {
+				nextutils.Debug("Transaction %s of disconnected block %s dropped: %v", transaction.ID, block.Hash, err)
+				continue
+			}
+			AddTransactionToPool(transaction)
+			returned++
+		}
+	}
+	return returned
+}
+
+// * REMOVE INVALID TRANSACTIONS FROM POOL * //
+// ? Entfernt alle Transaktionen, die auf dem aktuellen Tip nicht (mehr) gültig sind, z.B. nachdem
+// ? ein Block mit ihnen abgelehnt wurde. Gibt die Anzahl entfernter Transaktionen zurück.
+
+func RemoveInvalidTransactionsFromPool(ruleset RuleSet) int {
+	removed := 0
+	for _, transaction := range GetAllTransactionsFromPool() {
+		if valid, err := ValidatorValidateTransaction(transaction, ruleset); !valid || err != nil {
+			nextutils.Debug("Transaction %s dropped from pool: %v", transaction.ID, err)
+			RemoveTransactionFromPool(transaction)
+			removed++
+		}
+	}
+	return removed
+}
@@ -1,10 +1,8 @@
 package nxtblock
 
 import (
-	"crypto/sha256"
 	"encoding/json"
 	"fmt"
-	"math/rand"
 	"nxtchain/nxtutxodb"
 	"nxtchain/pqckpg_api"
 	"time"
@@ -33,12 +31,18 @@ type Transaction struct {
 }
 
 // * VALIDATE TRANSACTION * //
+// ? Hash und ID werden aus dem Inhalt nachgerechnet (sighash.go), jede Signatur muss über
+// ? diesen Digest gehen
 
 func ValidateTransaction(transaction Transaction) (bool, error) {
+	if err := CheckTransactionHashes(transaction); err != nil {
+		return false, err
+	}
+	sigHash := CalculateSigHash(transaction)
 	for _, input := range transaction.Inputs {
 		publicKey := input.PublicKey
 		signature := input.Signature
-		isValid := pqckpg_api.Verify([]byte(publicKey), []byte(transaction.Hash), []byte(signature))
+		isValid := pqckpg_api.Verify([]byte(publicKey), []byte(sigHash), []byte(signature))
 		if !isValid {
 			return false, fmt.Errorf("invalid signature for input with txid: %s",
 				input.Txid)
@@ -48,171 +52,116 @@ func ValidateTransaction(transaction Transaction) (bool, error) {
 }
 
 // * CHECK OUTPUTS AND INPUTS * //
+// ? Summen mit Überlaufprüfung, negative Outputs sind ungültig
 
-func CheckOutputInputs(transaction Transaction) bool {
-	var totalInputs int64 = 0
-	var totalOutputs int64 = 0
+func CheckOutputInputs(transaction Transaction, view *nxtutxodb.View) bool {
+	var totalInputs, totalOutputs Amount
 
 	for _, input := range transaction.Inputs {
-		amount, err := nxtutxodb.GetUTXOAmount(input.Txid, input.Index)
+		amount, err := view.Amount(input.Txid, input.Index)
 		if err != nil {
 			return false
 		}
-		totalInputs += amount
+		if totalInputs, err = totalInputs.Add(Amount(amount)); err != nil {
+			return false
+		}
 	}
 
 	for _, output := range transaction.Outputs {
-		totalOutputs += output.Amount
+		if output.Amount < 0 {
+			return false
+		}
+		var err error
+		if totalOutputs, err = totalOutputs.Add(Amount(output.Amount)); err != nil {
+			return false
+		}
 	}
 
 	return totalInputs >= totalOutputs
 }
 
 // * CHECK ALL UTXO FROM ONE TRANSACTION* //
+// ? Jeder Input muss auf einen unverbrauchten UTXO zeigen, der dem Sender gehört: die Adresse
+// ? seines Public Keys (GenerateWalletAddress) muss die Empfängeradresse des UTXO sein. Die
+// ? Signatur allein beweist nur den Besitz des mitgeschickten Keys.
 
-func CheckTransactionUTXOs(transaction Transaction) bool {
+func CheckTransactionUTXOs(transaction Transaction, view *nxtutxodb.View) error {
 	for _, input := range transaction.Inputs {
-		_, err := nxtutxodb.GetUTXOAmount(input.Txid, input.Index)
-		if err != nil {
-			return false
+		utxo, exists := view.Get(input.Txid, input.Index)
+		if !exists {
+			return fmt.Errorf("UTXO %s:%d not found or already spent", input.Txid, input.Index)
+		}
+		if owner := GenerateWalletAddress(input.PublicKey); owner != utxo.PubKey {
+			return fmt.Errorf("UTXO %s:%d belongs to %s, not to the spender %s", input.Txid, input.Index, utxo.PubKey, owner)
 		}
 	}
-	return true
+	return nil
 }
 
 // * CREATE TRANSACTION HEADER * //
 
-func CreateTransactionHeader(minerAddr string, reward int64) Transaction {
-	return Transaction{
-		ID:     GenerateTransactionID(),
-		Hash:   fmt.Sprintf("%x", sha256.Sum256([]byte(minerAddr))),
+func CreateTransactionHeader(minerAddr string, reward Amount, height int) Transaction {
+	transaction := Transaction{
 		Inputs: []TInput{},
 		Outputs: []TOutput{
 			{
 				Index:        0,
 				ReceiverAddr: minerAddr,
-				Amount:       reward,
+				Amount:       int64(reward),
 			},
 		},
 	}
-}
-
-// * DELETE ALL UTXO FROM TRANSACTION * //
-
-func DeleteTransactionUTXOs(transaction Transaction) {
-	for _, input := range transaction.Inputs {
-		nxtutxodb.RemoveUTXO(input.Txid, input.Index)
-	}
-}
-
-// * DELETE ALL UTXO FROM BLOCK * //
-
-func DeleteBlockUTXOs(transactions []Transaction) {
-	for _, transaction := range transactions {
-		DeleteTransactionUTXOs(transaction)
-	}
-}
-
-// * CONVERT BLOCK TRANSACTIONS TO UTXO * //
-func ConvertBlockToUTXO(block Block) {
-	for _, transaction := range block.Transactions {
-		for _, output := range transaction.Outputs {
-			if !UTXOExists(transaction.ID, output.Index) {
-				newUtxo := nxtutxodb.UTXO{
-					Txid:              transaction.ID,
-					Index:             output.Index,
-					Amount:            output.Amount,
-					PubKey:            output.ReceiverAddr,
-					BlockHeight:       block.BlockHeight,
-					IsHeadTransaction: false,
-				}
-				nxtutxodb.AddUTXOObject(newUtxo)
-			}
-		}
-	}
-	for _, transaction := range block.HeadTransactions {
-		for _, output := range transaction.Outputs {
-			if !UTXOExists(transaction.ID, output.Index) {
-				newUtxo := nxtutxodb.UTXO{
-					Txid:              transaction.ID,
-					Index:             output.Index,
-					Amount:            output.Amount,
-					PubKey:            output.ReceiverAddr,
-					BlockHeight:       block.BlockHeight,
-					IsHeadTransaction: true,
-				}
-				nxtutxodb.AddUTXOObject(newUtxo)
-			}
-		}
-	}
-}
-
-// * EXIST CHECK * //
-
-func UTXOExists(txid string, index int) bool {
-	for _, utxo := range nxtutxodb.UTXODatabase {
-		if utxo.Txid == txid && utxo.Index == index {
-			return true
-		}
-	}
-	return false
-}
-
-// * GENERATE TRANSACTION ID * //
-
-func GenerateTransactionID() string {
-	timestamp := time.Now().UnixNano()
-	random := rand.New(rand.NewSource(timestamp))
-	id := random.Int63()
-	return fmt.Sprintf("%d", id)
-}
-
-// * GENERATE TRANSACTION HASH * //
-
-func GenerateTransactionHash(transaction Transaction) string {
-	var data string
-	for _, input := range transaction.Inputs {
-		data += input.Txid + fmt.Sprintf("%d", input.Index)
-	}
-	for _, output := range transaction.Outputs {
-		data += output.ReceiverAddr + fmt.Sprintf("%d", output.Amount)
-	}
-	hashData := data + transaction.ID
-	hashData += GenerateTransactionID()
-	return fmt.Sprintf("%x", sha256.Sum256([]byte(hashData)))
+	transaction.Hash = CalculateSigHash(transaction)
+	transaction.ID = CalculateCoinbaseID(height, transaction)
+	return transaction
 }
 
 // * PREPARE TRANSACTION * //
+// ? Unsignierte Transaktion, Hash ist der Digest, den SignTransaction signiert
 
-func PrepareTransaction(outputs []TOutput) Transaction {
+func PrepareTransaction(inputs []TInput, outputs []TOutput) Transaction {
 
 	var transaction Transaction
-	transaction.ID = GenerateTransactionID()
 	transaction.Timestamp = time.Now().UnixNano()
+	transaction.Inputs = inputs
 	transaction.Outputs = outputs
-	transaction.Hash = GenerateTransactionHash(transaction)
+	transaction.Hash = CalculateSigHash(transaction)
+
+	return transaction
+}
+
+// * SIGN TRANSACTION * //
+// ? Signiert alle Inputs mit privateKey und setzt danach die ID (über den Inhalt inkl. Signaturen)
 
+func SignTransaction(transaction Transaction, privateKey []byte) Transaction {
+	transaction.Hash = CalculateSigHash(transaction)
+	inputs := make([]TInput, len(transaction.Inputs))
+	for i, input := range transaction.Inputs {
+		input.Signature = pqckpg_api.Sign(privateKey, []byte(transaction.Hash))
+		inputs[i] = input
+	}
+	transaction.Inputs = inputs
+	transaction.ID = CalculateTransactionID(transaction)
 	return transaction
 }
 
 // * CREATE TRANSACTION INPUT * //
+// ? Ohne Signatur, die kommt erst mit SignTransaction (der Digest deckt alle Inputs ab)
 
-func CreateTransactionInput(txid string, index int, privateKey []byte, publicKey []byte, hash string) TInput {
-	signature := pqckpg_api.Sign(privateKey, []byte(hash))
+func CreateTransactionInput(txid string, index int, publicKey []byte) TInput {
 	return TInput{
 		Txid:      txid,
 		Index:     index,
-		Signature: signature,
 		PublicKey: publicKey,
 	}
 }
 
 // * CREATE TRANSACTION OUTPUT * //
 
-func CreateTransactionOutput(index int, amount int64, receiverAddr string) TOutput {
+func CreateTransactionOutput(index int, amount Amount, receiverAddr string) TOutput {
 	return TOutput{
 		Index:        index,
-		Amount:       amount,
+		Amount:       int64(amount),
 		ReceiverAddr: receiverAddr,
 	}
 }
@@ -0,0 +1,92 @@
+package nxtblock
+
+import (
+	"nxtchain/nxtutxodb"
+	"strings"
+	"testing"
+)
+
+// * UTXO OWNERSHIP * //
+// ? Ein UTXO von Wallet A darf nur mit A's Key ausgegeben werden. Eine gültig signierte
+// ? Transaktion mit B's Key (oder mit A's Public Key, aber B's Signatur) muss abgelehnt werden.
+
+const ownedTxid = "owned-utxo-test"
+
+func seedOwnedUTXO(t *testing.T, owner Wallet) {
+	t.Helper()
+	nxtutxodb.AddUTXOObject(nxtutxodb.UTXO{
+		Txid:        ownedTxid,
+		Index:       0,
+		Amount:      1000,
+		PubKey:      GenerateWalletAddress(owner.PublicKey),
+		BlockHeight: 0,
+	})
+	t.Cleanup(func() {
+		nxtutxodb.RemoveUTXO(ownedTxid, 0)
+	})
+}
+
+func spendOwnedUTXO(publicKey []byte, privateKey []byte, receiver string) Transaction {
+	transaction := PrepareTransaction(
+		[]TInput{CreateTransactionInput(ownedTxid, 0, publicKey)},
+		[]TOutput{CreateTransactionOutput(0, 900, receiver)},
+	)
+	return SignTransaction(transaction, privateKey)
+}
+
+func TestSpendOwnUTXO(t *testing.T) {
+	a := CreateWallet([]byte("owner-a"))
+	seedOwnedUTXO(t, a)
+
+	transaction := spendOwnedUTXO(a.PublicKey, a.PrivateKey, GenerateWalletAddress(a.PublicKey))
+	if err := CheckTransactionUTXOs(transaction, nxtutxodb.NewView()); err != nil {
+		t.Fatalf("CheckTransactionUTXOs rejected the owner's spend: %v", err)
+	}
+	if valid, err := ValidatorValidateTransaction(transaction, DefaultRuleSet()); !valid || err != nil {
+		t.Fatalf("ValidatorValidateTransaction rejected the owner's spend: %t, %v", valid, err)
+	}
+}
+
+func TestSpendForeignUTXO(t *testing.T) {
+	a := CreateWallet([]byte("owner-a"))
+	b := CreateWallet([]byte("thief-b"))
+	seedOwnedUTXO(t, a)
+
+	// ? B signiert korrekt mit dem eigenen Key, der UTXO gehört aber A
+	transaction := spendOwnedUTXO(b.PublicKey, b.PrivateKey, GenerateWalletAddress(b.PublicKey))
+	if valid, err := ValidateTransaction(transaction); !valid || err != nil {
+		t.Fatalf("B's signature should be valid on its own: %t, %v", valid, err)
+	}
+	err := CheckTransactionUTXOs(transaction, nxtutxodb.NewView())
+	if err == nil || !strings.Contains(err.Error(), "belongs to") {
+		t.Fatalf("CheckTransactionUTXOs accepted B's spend of A's UTXO: %v", err)
+	}
+	if valid, err := ValidatorValidateTransaction(transaction, DefaultRuleSet()); valid || err == nil {
+		t.Fatalf("ValidatorValidateTransaction accepted B's spend of A's UTXO")
+	}
+
+	// ? B gibt A's Public Key an, kann aber nur mit dem eigenen Private Key signieren
+	transaction = spendOwnedUTXO(a.PublicKey, b.PrivateKey, GenerateWalletAddress(b.PublicKey))
+	if valid, err := ValidatorValidateTransaction(transaction, DefaultRuleSet()); valid || err == nil {
+		t.Fatalf("ValidatorValidateTransaction accepted A's key with B's signature")
+	}
+}
+
+func TestSpendUTXOTwiceInOneTransaction(t *testing.T) {
+	a := CreateWallet([]byte("owner-a"))
+	seedOwnedUTXO(t, a)
+
+	// ? Derselbe Outpoint zweimal, die Outputs zahlen den doppelten Betrag aus
+	transaction := PrepareTransaction(
+		[]TInput{
+			CreateTransactionInput(ownedTxid, 0, a.PublicKey),
+			CreateTransactionInput(ownedTxid, 0, a.PublicKey),
+		},
+		[]TOutput{CreateTransactionOutput(0, 1800, GenerateWalletAddress(a.PublicKey))},
+	)
+	transaction = SignTransaction(transaction, a.PrivateKey)
+	valid, err := ValidatorValidateTransaction(transaction, DefaultRuleSet())
+	if valid || err == nil || !strings.Contains(err.Error(), "same input twice") {
+		t.Fatalf("ValidatorValidateTransaction accepted a transaction spending one input twice: %t, %v", valid, err)
+	}
+}
@@ -0,0 +1,292 @@
+package nxtblock
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"nxtchain/nextutils"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// * TRANSACTION INDEX * //
+// ? Optionaler Index txid -> (Block, Höhe, Position) unter <block_dir>/index/tx.idx. Er wird beim
+// ? Übernehmen und Trennen von Blöcken der aktiven Kette fortgeschrieben (put/delete Einträge).
+// ? Ist er nicht aktiviert, durchsucht GetTransactionByID die aktive Kette.
+
+const txIndexFile = "tx.idx"
+
+type TxLocation struct {
+	BlockHash string `json:"block"`
+	Height    int    `json:"height"`
+	Position  int    `json:"pos"`
+	Head      bool   `json:"head,omitempty"` // Position in HeadTransactions statt Transactions
+}
+
+type txIndexEntry struct {
+	Op   string `json:"op"`
+	Txid string `json:"txid"`
+	TxLocation
+}
+
+type txIndex struct {
+	path   string
+	mutex  sync.RWMutex
+	byTxid map[string]TxLocation
+}
+
+var txIndexes = make(map[string]*txIndex)
+var txIndexesMutex sync.Mutex
+
+func txIndexPath(dir string) string {
+	return filepath.Join(dir, blockIndexDir, txIndexFile)
+}
+
+func getTxIndex(dir string) *txIndex {
+	txIndexesMutex.Lock()
+	defer txIndexesMutex.Unlock()
+	return txIndexes[filepath.Clean(dir)]
+}
+
+// * ENABLE TRANSACTION INDEX * //
+// ? Lädt den Index für ein block_dir. Fehlt er, ist er beschädigt oder enthält er den Tip nicht
+// ? (Absturz zwischen Block und Index), wird er aus der aktiven Kette neu aufgebaut.
+
+func EnableTxIndex(dir string) error {
+	if getTxIndex(dir) != nil {
+		return nil
+	}
+
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return err
+	}
+
+	index := &txIndex{path: txIndexPath(dir), byTxid: make(map[string]TxLocation)}
+	loaded, err := index.load()
+	if err != nil {
+		nextutils.Error("Error loading transaction index: %v", err)
+	}
+	if !loaded || !index.coversTip(store) {
+		nextutils.Info("Building transaction index for %s...", dir)
+		return RebuildTxIndex(dir)
+	}
+
+	txIndexesMutex.Lock()
+	txIndexes[filepath.Clean(dir)] = index
+	txIndexesMutex.Unlock()
+	nextutils.Debug("Transaction index loaded (%d transactions)", len(index.byTxid))
+	return nil
+}
+
+// * REBUILD TRANSACTION INDEX * //
+// ? Baut den Index aus allen Blöcken der aktiven Kette neu auf und aktiviert ihn. Auf einem
+// ? Pruned Node fehlen alte Blöcke, dann wird ErrHistoryPruned zurückgegeben.
+
+func RebuildTxIndex(dir string) error {
+	acceptMutex.Lock()
+	defer acceptMutex.Unlock()
+
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return err
+	}
+	if err := checkFullHistory(store); err != nil {
+		return err
+	}
+
+	index := &txIndex{path: txIndexPath(dir), byTxid: make(map[string]TxLocation)}
+	var data []byte
+	err = store.Iterate(func(block Block) error {
+		for _, entry := range blockTxIndexEntries(block, "put") {
+			line, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			data = append(data, line...)
+			data = append(data, '\n')
+			index.apply(entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error reading blocks: %v", err)
+	}
+	if err := nextutils.WriteFileAtomic(index.path, data, 0644); err != nil {
+		return fmt.Errorf("error writing transaction index: %v", err)
+	}
+
+	txIndexesMutex.Lock()
+	txIndexes[filepath.Clean(dir)] = index
+	txIndexesMutex.Unlock()
+	nextutils.Info("Transaction index built (%d transactions)", len(index.byTxid))
+	return nil
+}
+
+// * GET TRANSACTION BY ID * //
+// ? Gibt die Transaktion und ihren Ort in der aktiven Kette zurück
+
+func GetTransactionByID(dir string, txid string) (Transaction, TxLocation, error) {
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return Transaction{}, TxLocation{}, err
+	}
+
+	index := getTxIndex(dir)
+	if index == nil {
+		return findTransaction(store, txid)
+	}
+
+	index.mutex.RLock()
+	location, exists := index.byTxid[txid]
+	index.mutex.RUnlock()
+	if !exists {
+		return Transaction{}, TxLocation{}, fmt.Errorf("transaction %s not found", txid)
+	}
+
+	// ? Nur Blöcke der aktiven Kette zählen (ein Absturz beim Trennen kann Einträge hinterlassen)
+	block, err := store.GetByHeight(location.Height)
+	if err != nil || block.Hash != location.BlockHash {
+		return Transaction{}, TxLocation{}, fmt.Errorf("transaction %s not found in active chain", txid)
+	}
+	if isBlockHeader(block) {
+		return Transaction{}, TxLocation{}, fmt.Errorf("block %s containing transaction %s is pruned", block.Hash, txid)
+	}
+	transactions := block.Transactions
+	if location.Head {
+		transactions = block.HeadTransactions
+	}
+	if location.Position >= len(transactions) || transactions[location.Position].ID != txid {
+		return Transaction{}, TxLocation{}, fmt.Errorf("transaction index entry for %s does not match block %s", txid, block.Hash)
+	}
+	return transactions[location.Position], location, nil
+}
+
+// ? Ohne Index: aktive Kette vom Tip abwärts durchsuchen
+func findTransaction(store BlockStore, txid string) (Transaction, TxLocation, error) {
+	for height := store.Height(); height >= 0; height-- {
+		block, err := store.GetByHeight(height)
+		if err != nil {
+			continue
+		}
+		for _, entry := range blockTxIndexEntries(block, "put") {
+			if entry.Txid != txid {
+				continue
+			}
+			if entry.Head {
+				return block.HeadTransactions[entry.Position], entry.TxLocation, nil
+			}
+			return block.Transactions[entry.Position], entry.TxLocation, nil
+		}
+	}
+	return Transaction{}, TxLocation{}, fmt.Errorf("transaction %s not found", txid)
+}
+
+// * UPDATE INDEX * //
+// ? Wird nach dem Übernehmen bzw. Trennen eines Blocks aufgerufen. Schlägt das Schreiben fehl,
+// ? wird der Index verworfen und beim nächsten Start neu aufgebaut.
+
+func indexBlockTransactions(dir string, block Block) {
+	updateTxIndex(dir, blockTxIndexEntries(block, "put"))
+}
+
+func unindexBlockTransactions(dir string, block Block) {
+	updateTxIndex(dir, blockTxIndexEntries(block, "delete"))
+}
+
+func updateTxIndex(dir string, entries []txIndexEntry) {
+	index := getTxIndex(dir)
+	if index == nil || len(entries) == 0 {
+		return
+	}
+
+	var data []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			nextutils.Error("Error encoding transaction index entry: %v", err)
+			return
+		}
+		data = append(data, line...)
+		data = append(data, '\n')
+	}
+	if err := nextutils.AppendFileSync(index.path, data, 0644); err != nil {
+		nextutils.Error("Error writing transaction index, disabling it until the next start: %v", err)
+		txIndexesMutex.Lock()
+		delete(txIndexes, filepath.Clean(dir))
+		txIndexesMutex.Unlock()
+		if err := os.Remove(index.path); err != nil && !os.IsNotExist(err) {
+			nextutils.Error("Error removing transaction index: %v", err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		index.apply(entry)
+	}
+}
+
+func blockTxIndexEntries(block Block, op string) []txIndexEntry {
+	var entries []txIndexEntry
+	for i, transaction := range block.HeadTransactions {
+		entries = append(entries, txIndexEntry{Op: op, Txid: transaction.ID, TxLocation: TxLocation{BlockHash: block.Hash, Height: block.BlockHeight, Position: i, Head: true}})
+	}
+	for i, transaction := range block.Transactions {
+		entries = append(entries, txIndexEntry{Op: op, Txid: transaction.ID, TxLocation: TxLocation{BlockHash: block.Hash, Height: block.BlockHeight, Position: i}})
+	}
+	return entries
+}
+
+// * LOAD INDEX * //
+
+func (i *txIndex) load() (bool, error) {
+	file, err := os.Open(i.path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry txIndexEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return false, fmt.Errorf("corrupt transaction index entry: %v", err)
+		}
+		i.apply(entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (i *txIndex) apply(entry txIndexEntry) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	switch entry.Op {
+	case "put":
+		i.byTxid[entry.Txid] = entry.TxLocation
+	case "delete":
+		if location, exists := i.byTxid[entry.Txid]; exists && location.BlockHash == entry.BlockHash {
+			delete(i.byTxid, entry.Txid)
+		}
+	}
+}
+
+// ? Enthält der Index alle Transaktionen des aktuellen Tips?
+func (i *txIndex) coversTip(store BlockStore) bool {
+	tip, err := store.Tip()
+	if err != nil {
+		return len(i.byTxid) == 0
+	}
+	for _, entry := range blockTxIndexEntries(tip, "put") {
+		if location, exists := i.byTxid[entry.Txid]; !exists || location.BlockHash != tip.Hash {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+package nxtblock
+
+import (
+	"encoding/json"
+	"fmt"
+	"nxtchain/nextutils"
+	"nxtchain/nxtutxodb"
+	"os"
+	"path/filepath"
+)
+
+// * UNDO DATA * //
+// ? Zu jedem übernommenen Block wird unter <block_dir>/undo/<hash>.undo gespeichert, welche UTXOs
+// ? er verbraucht hat (mit allen ursprünglichen Feldern). Damit kann der Block später wieder aus
+// ? dem UTXO Set entfernt werden (DisconnectBlock).
+
+const blockUndoDir = "undo"
+
+type BlockUndo struct {
+	Hash         string           `json:"hash"`
+	Height       int              `json:"height"`
+	PreviousHash string           `json:"previous_hash"`
+	Spent        []nxtutxodb.UTXO `json:"spent"`
+}
+
+func undoPath(dir string, hash string) string {
+	return filepath.Join(dir, blockUndoDir, hash+".undo")
+}
+
+// * CREATE UNDO DATA * //
+// ? Muss vor dem Übernehmen des Blocks aufgerufen werden, solange die Inputs noch im UTXO Set sind
+
+func CreateBlockUndo(block Block) (BlockUndo, error) {
+	return createBlockUndo(block, nxtutxodb.NewView())
+}
+
+// ? view muss den Stand vor dem Block zeigen
+func createBlockUndo(block Block, view *nxtutxodb.View) (BlockUndo, error) {
+	undo := BlockUndo{Hash: block.Hash, Height: block.BlockHeight, PreviousHash: block.PreviousHash}
+	for _, transaction := range block.Transactions {
+		for _, input := range transaction.Inputs {
+			utxo, exists := view.Get(input.Txid, input.Index)
+			if !exists {
+				return undo, fmt.Errorf("UTXO %s:%d spent by block %s not found", input.Txid, input.Index, block.Hash)
+			}
+			undo.Spent = append(undo.Spent, utxo)
+		}
+	}
+	return undo, nil
+}
+
+// * SAVE UNDO DATA * //
+
+func SaveBlockUndo(undo BlockUndo, dir string) error {
+	data, err := json.Marshal(undo)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, blockUndoDir), 0755); err != nil {
+		return err
+	}
+	return nextutils.WriteFileAtomic(undoPath(dir, undo.Hash), data, 0644)
+}
+
+// * LOAD UNDO DATA * //
+
+func LoadBlockUndo(hash string, dir string) (BlockUndo, error) {
+	data, err := os.ReadFile(undoPath(dir, hash))
+	if err != nil {
+		return BlockUndo{}, err
+	}
+	var undo BlockUndo
+	if err := json.Unmarshal(data, &undo); err != nil {
+		return BlockUndo{}, err
+	}
+	return undo, nil
+}
+
+// * DELETE UNDO DATA * //
+
+func DeleteBlockUndo(hash string, dir string) error {
+	if err := os.Remove(undoPath(dir, hash)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// * DISCONNECT BLOCK * //
+// ? Entfernt den aktuellen Tip aus dem UTXO Set: die vom Block erzeugten UTXOs werden gelöscht,
+// ? die verbrauchten aus den Undo-Daten wiederhergestellt. Die Blockdatei selbst bleibt erhalten.
+
+func DisconnectBlock(block Block, dir string) error {
+	if tip := nxtutxodb.Tip(); tip.Hash != block.Hash {
+		return fmt.Errorf("block %s is not the utxo tip (tip is %s)", block.Hash, tip.Hash)
+	}
+	if isBlockHeader(block) {
+		return fmt.Errorf("block %s is pruned and cannot be disconnected", block.Hash)
+	}
+	undo, err := LoadBlockUndo(block.Hash, dir)
+	if err != nil {
+		return fmt.Errorf("no undo data for block %s: %v", block.Hash, err)
+	}
+
+	var removed []string
+	for _, utxo := range BlockUTXOs(block) {
+		removed = append(removed, fmt.Sprintf("%s:%d", utxo.Txid, utxo.Index))
+	}
+
+	parent := nxtutxodb.BlockRef{}
+	if block.PreviousHash != "GENESIS" {
+		parent = nxtutxodb.BlockRef{Hash: block.PreviousHash, Height: block.BlockHeight - 1}
+	}
+	if err := nxtutxodb.RevertBlock(block.Hash, parent, removed, undo.Spent); err != nil {
+		return fmt.Errorf("error updating utxo database: %v", err)
+	}
+	unindexBlockTransactions(dir, block)
+	unindexBlockAddresses(dir, block)
+	return nil
+}
+
+// * INVALIDATE TIP * //
+// ? Operator-Aktion: trennt den lokalen Tip vom UTXO Set, löscht den Block und gibt seine
+// ? noch gültigen Transaktionen zurück in den Transaktionspool
+
+func InvalidateTip(dir string, ruleset RuleSet) (Block, int, error) {
+	acceptMutex.Lock()
+	defer acceptMutex.Unlock()
+
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return Block{}, 0, err
+	}
+	block, err := store.Tip()
+	if err != nil {
+		return Block{}, 0, fmt.Errorf("no local blocks: %v", err)
+	}
+
+	if err := DisconnectBlock(block, dir); err != nil {
+		return block, 0, err
+	}
+	if err := store.Delete(block.Hash); err != nil {
+		return block, 0, fmt.Errorf("error removing block %s: %v", block.Hash, err)
+	}
+	if err := DeleteBlockUndo(block.Hash, dir); err != nil {
+		nextutils.Error("Error removing undo data of block %s: %v", block.Hash, err)
+	}
+	return block, returnTransactionsToPool([]Block{block}, ruleset), nil
+}
@@ -0,0 +1,182 @@
+package nxtblock
+
+import (
+	"fmt"
+	"nxtchain/nxtutxodb"
+)
+
+// * SPENT UTXO KEYS OF BLOCK * //
+
+func BlockSpentKeys(block Block) []string {
+	var keys []string
+	for _, transaction := range block.Transactions {
+		for _, input := range transaction.Inputs {
+			keys = append(keys, fmt.Sprintf("%s:%d", input.Txid, input.Index))
+		}
+	}
+	return keys
+}
+
+// * CREATED UTXOS OF BLOCK * //
+
+func BlockUTXOs(block Block) []nxtutxodb.UTXO {
+	var utxos []nxtutxodb.UTXO
+	for _, transaction := range block.Transactions {
+		for _, output := range transaction.Outputs {
+			utxos = append(utxos, nxtutxodb.UTXO{
+				Txid:              transaction.ID,
+				Index:             output.Index,
+				Amount:            output.Amount,
+				PubKey:            output.ReceiverAddr,
+				BlockHeight:       block.BlockHeight,
+				IsHeadTransaction: false,
+			})
+		}
+	}
+	for _, transaction := range block.HeadTransactions {
+		for _, output := range transaction.Outputs {
+			utxos = append(utxos, nxtutxodb.UTXO{
+				Txid:              transaction.ID,
+				Index:             output.Index,
+				Amount:            output.Amount,
+				PubKey:            output.ReceiverAddr,
+				BlockHeight:       block.BlockHeight,
+				IsHeadTransaction: true,
+			})
+		}
+	}
+	return utxos
+}
+
+// * UTXO STATE * //
+// ? Commitment und Tip der UTXO Datenbank, so wie sie beim Peer-Sync ausgetauscht werden.
+// ? Beide werden unter acceptMutex gelesen, damit sie zum selben Block gehören.
+
+type UTXOState struct {
+	Commitment string
+	Tip        nxtutxodb.BlockRef
+}
+
+func GetUTXOState() UTXOState {
+	acceptMutex.Lock()
+	defer acceptMutex.Unlock()
+	return UTXOState{Commitment: nxtutxodb.Commitment(), Tip: nxtutxodb.Tip()}
+}
+
+// ? Wie GetUTXOState, zusätzlich eine Kopie des Sets zu genau diesem Stand
+func CopyUTXOState() (UTXOState, map[string]nxtutxodb.UTXO) {
+	acceptMutex.Lock()
+	defer acceptMutex.Unlock()
+	return UTXOState{Commitment: nxtutxodb.Commitment(), Tip: nxtutxodb.Tip()}, nxtutxodb.CopyUTXODatabase()
+}
+
+// * SET PEER UTXO DATABASE * //
+// ? Übernimmt ein von Peers geladenes Set. Es muss zum gewählten Commitment passen und beim
+// ? lokalen Tip gebildet worden sein, sonst würden danach angenommene Blöcke doppelt oder auf
+// ? dem falschen Stand angewendet.
+
+func SetPeerUTXODatabase(dir string, utxos map[string]nxtutxodb.UTXO, state UTXOState) error {
+	if hash := nxtutxodb.CommitmentHash(utxos); hash != state.Commitment {
+		return fmt.Errorf("utxo set does not match commitment: got %s, want %s", hash, state.Commitment)
+	}
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return err
+	}
+
+	acceptMutex.Lock()
+	defer acceptMutex.Unlock()
+
+	localTip, err := store.Tip()
+	if err != nil {
+		localTip = Block{}
+	}
+	if state.Tip.Hash != localTip.Hash || state.Tip.Height != localTip.BlockHeight {
+		return fmt.Errorf("utxo set was built at %s (height %d), local chain tip is %s (height %d)", state.Tip.Hash, state.Tip.Height, localTip.Hash, localTip.BlockHeight)
+	}
+	return nxtutxodb.SetUTXODatabase(utxos, state.Tip)
+}
+
+// * VERIFY UTXO DATABASE * //
+// ? Prüft die persistierte UTXO Datenbank gegen die lokalen Blockdateien: der Snapshot und alle
+// ? Journal-Einträge müssen auf lokal gespeicherte Blöcke zeigen, die neuen UTXOs eines Eintrags
+// ? müssen den Outputs des Blocks entsprechen und der Stand muss beim lokalen Tip enden.
+// ? Bei einem von Peers übernommenen Set lässt sich der Inhalt des Snapshots nicht nachrechnen,
+// ? sein Tip muss aber ein lokaler Block der aktiven Kette sein.
+
+func VerifyUTXODatabase(dir string) error {
+	store, err := GetBlockStore(dir)
+	if err != nil {
+		return err
+	}
+
+	checkRef := func(ref nxtutxodb.BlockRef) (Block, error) {
+		block, err := store.Get(ref.Hash)
+		if err != nil {
+			return Block{}, fmt.Errorf("block %s at height %d not found locally: %v", ref.Hash, ref.Height, err)
+		}
+		if block.BlockHeight != ref.Height {
+			return Block{}, fmt.Errorf("block %s has height %d, utxo database expects %d", ref.Hash, block.BlockHeight, ref.Height)
+		}
+		return block, nil
+	}
+
+	snapshotTip, entries := nxtutxodb.AppliedBlocks()
+	if nxtutxodb.Source() == nxtutxodb.SourcePeers {
+		if snapshotTip.Hash == "" {
+			return fmt.Errorf("utxo database was synced from peers without a tip block")
+		}
+		if main, err := store.GetByHeight(snapshotTip.Height); err != nil || main.Hash != snapshotTip.Hash {
+			return fmt.Errorf("snapshot: peer tip %s at height %d is not part of the local chain", snapshotTip.Hash, snapshotTip.Height)
+		}
+	}
+	if snapshotTip.Hash != "" {
+		if _, err := checkRef(snapshotTip); err != nil {
+			return fmt.Errorf("snapshot: %v", err)
+		}
+	}
+	reverted := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Reverted != "" {
+			reverted[entry.Reverted] = true
+		}
+	}
+	for _, entry := range entries {
+		if entry.Reverted == "" && reverted[entry.Block.Hash] && !store.Has(entry.Block.Hash) {
+			// ? Später zurückgenommen und gelöscht (InvalidateTip)
+			continue
+		}
+		if entry.Reverted != "" {
+			// ? Zurückgenommener Block: Block ist der neue Tip (leer, wenn alle Blöcke entfernt wurden)
+			if entry.Block.Hash != "" {
+				if _, err := checkRef(entry.Block); err != nil {
+					return fmt.Errorf("journal entry %d: %v", entry.Seq, err)
+				}
+			}
+			continue
+		}
+		block, err := checkRef(entry.Block)
+		if err != nil {
+			return fmt.Errorf("journal entry %d: %v", entry.Seq, err)
+		}
+		expected := BlockUTXOs(block)
+		if len(expected) != len(entry.Created) {
+			return fmt.Errorf("journal entry %d: block %s creates %d utxos, journal has %d", entry.Seq, block.Hash, len(expected), len(entry.Created))
+		}
+		for i := range expected {
+			if expected[i] != entry.Created[i] {
+				return fmt.Errorf("journal entry %d: utxo %s:%d does not match block %s", entry.Seq, entry.Created[i].Txid, entry.Created[i].Index, block.Hash)
+			}
+		}
+	}
+
+	tip := nxtutxodb.Tip()
+	localTip, err := store.Tip()
+	if err != nil {
+		localTip = Block{}
+	}
+	if tip.Hash != localTip.Hash {
+		return fmt.Errorf("utxo database ends at %s (height %d), local chain tip is %s (height %d)", tip.Hash, tip.Height, localTip.Hash, localTip.BlockHeight)
+	}
+	return nil
+}
@@ -1,18 +1,33 @@
 package nxtblock
 
 import (
-	"crypto/sha256"
 	"fmt"
+	"nxtchain/nxtutxodb"
 	"time"
 )
 
-func ValidatorValidateTransaction(transaction Transaction) (bool, error) {
+// ? Validierung verändert die UTXO Datenbank nicht. Geprüft wird gegen eine nxtutxodb.View,
+// ? übernommen wird erst mit View.Commit (connectBlock), wenn der Block angenommen ist.
+
+// ? Prüft eine Transaktion für den nächsten Block auf dem aktuellen Tip (Mempool)
+func ValidatorValidateTransaction(transaction Transaction, ruleset RuleSet) (bool, error) {
+	view := nxtutxodb.NewView()
+	return validateTransaction(transaction, view, nxtutxodb.Tip().Height+1, ruleset.CoinbaseMaturity)
+}
+
+// ? height ist die Höhe des Blocks, in dem die Transaktion steht
+func validateTransaction(transaction Transaction, view *nxtutxodb.View, height int, maturity int) (bool, error) {
+	// * 0. Jeder Input nur einmal (sonst würde sein Betrag doppelt gezählt)
+	if IsInputAlreadyUsed([]Transaction{transaction}) {
+		return false, fmt.Errorf("transaction %s spends the same input twice", transaction.ID)
+	}
+
 	// * 1. Schauen ob die Transaktion gültig ist (Input > Output)
-	if valid := CheckOutputInputs(transaction); !valid {
+	if valid := CheckOutputInputs(transaction, view); !valid {
 		return false, fmt.Errorf("total input amount is less than output amount")
 	}
 
-	// * 2. Transaktionen validieren (Public Key, Signature des Hashes)
+	// * 2. Transaktionen validieren (Hash und ID nachrechnen, Signaturen über den Digest)
 	valid, err := ValidateTransaction(transaction)
 	if err != nil {
 		return false, fmt.Errorf("transaction validation error: %v", err)
@@ -21,9 +36,14 @@ func ValidatorValidateTransaction(transaction Transaction) (bool, error) {
 		return false, fmt.Errorf("invalid transaction signature or public key")
 	}
 
-	// * 3. Schauen ob die UTXO noch gültig ist und in der UTXO Datenbank vorhanden ist
-	if valid := CheckTransactionUTXOs(transaction); !valid {
-		return false, fmt.Errorf("UTXO not found or already spent")
+	// * 3. Schauen ob die UTXO noch gültig ist, in der UTXO Datenbank vorhanden ist und dem Sender gehört
+	if err := CheckTransactionUTXOs(transaction, view); err != nil {
+		return false, err
+	}
+
+	// * 4. Outputs von Head-Transaktionen erst nach CoinbaseMaturity Blöcken ausgeben
+	if err := CheckCoinbaseMaturity(transaction, view, height, maturity); err != nil {
+		return false, err
 	}
 	return true, nil
 }
@@ -44,36 +64,41 @@ func IsInputAlreadyUsed(transactions []Transaction) bool {
 	return false
 }
 
+// * VALIDATE BLOCK * //
+// ? Prüft einen Block gegen den aktuellen Stand der UTXO Datenbank (Vorgänger = Tip), ohne ihn
+// ? zu verändern
+
 func ValidatorValidateBlock(block Block, blockdir string, ruleset RuleSet) (bool, error) {
-	// ? Block ID und Hash korrekt? (Nachbilden und vergleichen)
-	blockidparts := fmt.Sprintf("%d%s%v%v%v",
-		block.Timestamp,
-		block.PreviousHash,
-		CalculateBlockFee(block.Transactions),
-		block.TransactionHash,
-		block.HeadTransactions[0].Hash)
-	blockID := fmt.Sprintf("%x", sha256.Sum256([]byte(blockidparts)))
-	blockHashParts := fmt.Sprintf("%s%d%s%s%s%d%s",
-		blockID,
-		block.Timestamp,
-		block.PreviousHash,
-		block.Data,
-		block.TransactionHash,
-		block.Nonce,
-		block.Currency,
-	)
-	hashBytes := sha256.Sum256([]byte(blockHashParts))
-	blockHash := fmt.Sprintf("%x", hashBytes)
-	if block.Hash != blockHash {
-		return false, fmt.Errorf("block hash mismatch: got %s, want %s : %s AND: %s : Fee: %d", block.Hash, blockHash, blockHashParts, blockidparts, CalculateBlockFee(block.Transactions))
-	}
-	if block.Id != blockID {
-		return false, fmt.Errorf("block ID mismatch: got %s, want %s", block.Id, blockID)
+	return validateBlock(block, blockdir, ruleset, nxtutxodb.NewView())
+}
+
+// ? Wie ValidatorValidateBlock, die Änderungen des Blocks stehen danach (nur bei Erfolg) in view
+func validateBlock(block Block, blockdir string, ruleset RuleSet, view *nxtutxodb.View) (bool, error) {
+	if len(block.HeadTransactions) != 1 {
+		return false, fmt.Errorf("block must have exactly one head transaction, got %d", len(block.HeadTransactions))
+	}
+	// ? Blockhash korrekt? (Hash des kanonischen Headers nachbilden und vergleichen)
+	header, err := GetBlockHeader(block)
+	if err != nil {
+		return false, fmt.Errorf("invalid block header: %v", err)
+	}
+	if blockHash := header.Hash(); block.Hash != blockHash {
+		return false, fmt.Errorf("block hash mismatch: got %s, want %s", block.Hash, blockHash)
+	}
+	if block.Id != block.Hash {
+		return false, fmt.Errorf("block ID mismatch: got %s, want %s", block.Id, block.Hash)
+	}
+
+	// ? Proof of Work erfüllt? (Hash höchstens das Target des Blocks)
+	if !HasProofOfWork(block) {
+		return false, fmt.Errorf("block hash does not meet target %08x", block.Ruleset.Bits)
 	}
 
 	// ? Previous Hash korrekt? (Vorheriger Block)
+	previousBlock := Block{}
 	if block.PreviousHash != "GENESIS" {
-		previousBlock, err := GetBlockByHash(blockdir, block.PreviousHash)
+		var err error
+		previousBlock, err = GetBlockByHash(blockdir, block.PreviousHash)
 		if err != nil {
 			return false, err
 		}
@@ -89,20 +114,36 @@ func ValidatorValidateBlock(block Block, blockdir string, ruleset RuleSet) (bool
 
 	}
 
-	// ? Timestamp korrekt? (Nicht zukunft)
-	if block.Timestamp > GetTimestamp() {
-		return false, fmt.Errorf("block timestamp is in the future: %d", block.Timestamp)
+	store, err := GetBlockStore(blockdir)
+	if err != nil {
+		return false, err
 	}
 
-	// ? Transaktionhash korrekt? (Alle Transaktionen)
-	transactionHash := CalculateTransactionHash(block.Transactions)
+	// ? Timestamp korrekt? (Nach dem Median der letzten Blöcke, nicht zu weit in der Zukunft)
+	if err := checkBlockMedianTime(store, block, previousBlock); err != nil {
+		return false, err
+	}
+	if err := checkBlockFutureTime(block); err != nil {
+		return false, err
+	}
+
+	// ? Merkle Root korrekt? (Alle Transaktionen inkl. Head-Transaktion)
+	transactionHash := CalculateMerkleRoot(block)
 	if block.TransactionHash != transactionHash {
 		return false, fmt.Errorf("transaction hash mismatch: got %s, want %s", block.TransactionHash, transactionHash)
 	}
+	if err := checkDuplicateTransactions(block); err != nil {
+		return false, err
+	}
 
 	// ? Anzahl (Nicht mehr als MaxTransactions)
-	if len(block.Transactions) > block.Ruleset.MaxTransactions {
-		return false, fmt.Errorf("too many transactions in block: %d > %d", len(block.Transactions), block.Ruleset.MaxTransactions)
+	if len(block.Transactions) > ruleset.MaxTransactions {
+		return false, fmt.Errorf("too many transactions in block: %d > %d", len(block.Transactions), ruleset.MaxTransactions)
+	}
+
+	// ? Größe (Nicht mehr als MaxBlockSize Bytes, Header und Transaktionen)
+	if err := checkBlockSize(block, ruleset.MaxBlockSize); err != nil {
+		return false, err
 	}
 
 	// ? Jede Transaktion einmalig? (Double Spending)
@@ -112,7 +153,7 @@ func ValidatorValidateBlock(block Block, blockdir string, ruleset RuleSet) (bool
 
 	// ? Jede Transaktion gültig? (Transaktionen validieren)
 	for _, tx := range block.Transactions {
-		valid, err := ValidatorValidateTransaction(tx)
+		valid, err := validateTransaction(tx, view, block.BlockHeight, ruleset.CoinbaseMaturity)
 		if err != nil {
 			return false, err
 		}
@@ -121,32 +162,46 @@ func ValidatorValidateBlock(block Block, blockdir string, ruleset RuleSet) (bool
 		}
 	}
 
-	// ? Blockgebühr und Belohnung korrekt? (Block Reward)
-	blockFee := CalculateBlockFee(block.Transactions)
-	blockReward := CalculateBlockReward(block.Ruleset.InitialReward, int64(block.BlockHeight))
-	fullReward := blockFee + blockReward
-	if block.HeadTransactions[0].Outputs[0].Amount != fullReward {
-		return false, fmt.Errorf("invalid block reward: got %d, want %d", block.HeadTransactions[0].Outputs[0].Amount, fullReward)
+	// ? Head-Transaktion korrekt? (Keine Inputs, deterministische ID, Belohnung + Gebühren nach
+	// ? dem eigenen Ruleset, nicht dem des Blocks)
+	blockFee, err := calculateBlockFee(block.Transactions, view)
+	if err != nil {
+		return false, err
 	}
-
-	// ? Sind alle UTXO Inputs gelöscht? (Lokale UTXO Datenbank checken)
-	for _, tx := range block.Transactions {
-		DeleteTransactionUTXOs(tx)
+	fullReward, err := blockFee.Add(Amount(CalculateBlockReward(ruleset.InitialReward, int64(block.BlockHeight))))
+	if err != nil {
+		return false, fmt.Errorf("block reward: %v", err)
+	}
+	if err := checkCoinbase(block, fullReward); err != nil {
+		return false, err
 	}
 
-	// ? Sind alle UTXO Outputs erstellt? (Lokale UTXO Datenbank checken)
-	ConvertBlockToUTXO(block)
-
-	// ? Ist das Ruleset gleich und die Difficulty? (Regeln)
-	if block.Ruleset.Difficulty != ruleset.Difficulty {
-		return false, fmt.Errorf("invalid difficulty: got %d, want %d", block.Ruleset.Difficulty, ruleset.Difficulty)
+	// ? Target korrekt? (Retargeting aus den Vorgängern, difficulty.go)
+	if err := checkBlockBits(store, block, previousBlock, ruleset); err != nil {
+		return false, err
 	}
+
+	// ? Ist das Ruleset gleich? (Regeln)
 	if block.Ruleset.Version != ruleset.Version {
 		return false, fmt.Errorf("invalid version: got %d, want %d", block.Ruleset.Version, ruleset.Version)
 	}
 	if block.Ruleset.MaxTransactions != ruleset.MaxTransactions {
 		return false, fmt.Errorf("invalid max transactions: got %d, want %d", block.Ruleset.MaxTransactions, ruleset.MaxTransactions)
 	}
+	if block.Ruleset.InitialReward != ruleset.InitialReward {
+		return false, fmt.Errorf("invalid initial reward: got %d, want %d", block.Ruleset.InitialReward, ruleset.InitialReward)
+	}
+	if block.Ruleset.CoinbaseMaturity != ruleset.CoinbaseMaturity {
+		return false, fmt.Errorf("invalid coinbase maturity: got %d, want %d", block.Ruleset.CoinbaseMaturity, ruleset.CoinbaseMaturity)
+	}
+	if block.Ruleset.MaxBlockSize != ruleset.MaxBlockSize {
+		return false, fmt.Errorf("invalid max block size: got %d, want %d", block.Ruleset.MaxBlockSize, ruleset.MaxBlockSize)
+	}
+
+	// ? UTXO Änderungen des Blocks in der Sicht vormerken (Inputs ausgeben, Outputs erstellen)
+	if err := stageBlock(block, view); err != nil {
+		return false, err
+	}
 
 	return true, nil
 }
@@ -154,3 +209,23 @@ func ValidatorValidateBlock(block Block, blockdir string, ruleset RuleSet) (bool
 func GetTimestamp() int64 {
 	return time.Now().Unix()
 }
+
+// * STAGE BLOCK * //
+// ? Überträgt die UTXO Änderungen eines Blocks in eine Sicht, in derselben Reihenfolge wie
+// ? BlockSpentKeys und BlockUTXOs
+
+func stageBlock(block Block, view *nxtutxodb.View) error {
+	for _, transaction := range block.Transactions {
+		for _, input := range transaction.Inputs {
+			if err := view.Spend(input.Txid, input.Index); err != nil {
+				return err
+			}
+		}
+	}
+	for _, utxo := range BlockUTXOs(block) {
+		if err := view.Add(utxo); err != nil {
+			return fmt.Errorf("block %s: %v", block.Hash, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package nxtblock
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// * TARGET * //
+// ? Der Blockhash (als 256-Bit Zahl, Big Endian) muss kleiner oder gleich dem Target sein. Im
+// ? Ruleset und im Header steht das Target kompakt (Bits, wie bei Bitcoin): das oberste Byte ist
+// ? die Länge in Bytes, die unteren drei Bytes die Mantisse (0x00800000 ist das Vorzeichenbit und
+// ? damit ungültig). Ein Target von 2^(256-4d) entspricht d führenden Hex-Nullen (DifficultyBits).
+
+// ? Größtes erlaubtes Target (niedrigste Difficulty)
+var PowLimit = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+// * COMPACT TO TARGET * //
+
+func CompactToTarget(bits uint32) (*big.Int, error) {
+	size := uint(bits >> 24)
+	mantissa := int64(bits & 0x007fffff)
+	if bits&0x00800000 != 0 && mantissa != 0 {
+		return nil, fmt.Errorf("negative target %08x", bits)
+	}
+
+	target := big.NewInt(mantissa)
+	if size <= 3 {
+		target.Rsh(target, 8*(3-size))
+	} else {
+		target.Lsh(target, 8*(size-3))
+	}
+	if target.Sign() == 0 {
+		return nil, fmt.Errorf("zero target %08x", bits)
+	}
+	if target.Cmp(PowLimit) > 0 {
+		return nil, fmt.Errorf("target %08x exceeds the limit", bits)
+	}
+	return target, nil
+}
+
+// * TARGET TO COMPACT * //
+// ? Rundet ab (die Mantisse behält die obersten drei Bytes)
+
+func TargetToCompact(target *big.Int) uint32 {
+	if target.Sign() <= 0 {
+		return 0
+	}
+	size := uint((target.BitLen() + 7) / 8)
+	var mantissa uint32
+	if size <= 3 {
+		mantissa = uint32(target.Uint64() << (8 * (3 - size)))
+	} else {
+		mantissa = uint32(new(big.Int).Rsh(target, 8*(size-3)).Uint64())
+	}
+	// ? Vorzeichenbit gesetzt: ein Byte mehr, Mantisse eine Stelle nach rechts
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		size++
+	}
+	return uint32(size<<24) | mantissa
+}
+
+// * DIFFICULTY BITS * //
+// ? Bits für d führende Hex-Nullen (früheres Difficulty-Format, z.B. aus alten Configs)
+
+func DifficultyBits(zeros int) uint32 {
+	if zeros <= 0 {
+		return TargetToCompact(PowLimit)
+	}
+	if zeros > 63 {
+		zeros = 63
+	}
+	return TargetToCompact(new(big.Int).Lsh(big.NewInt(1), uint(256-4*zeros)))
+}
+
+// * BLOCK WORK * //
+// ? Erwartete Anzahl Hashes für einen Block: 2^256 / (Target + 1)
+
+func BlockWork(block Block) *big.Int {
+	target, err := CompactToTarget(block.Ruleset.Bits)
+	if err != nil {
+		return big.NewInt(0)
+	}
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+	return work.Div(work, target.Add(target, big.NewInt(1)))
+}
+
+// * PROOF OF WORK * //
+// ? Ist der Blockhash (als Zahl) kleiner oder gleich dem Target des Blocks?
+
+func HasProofOfWork(block Block) bool {
+	target, err := CompactToTarget(block.Ruleset.Bits)
+	if err != nil {
+		return false
+	}
+	hash, err := parseBlockHash(block.Hash)
+	if err != nil {
+		return false
+	}
+	return new(big.Int).SetBytes(hash[:]).Cmp(target) <= 0
+}
@@ -0,0 +1,126 @@
+package nxtutxodb
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"nxtchain/nextutils"
+)
+
+// * UTXO COMMITMENT * //
+// ? Multiplikativer Set Hash (MuHash): jeder Eintrag (Key und UTXO) wird auf eine Zahl modulo
+// ? der Primzahl 2^3072 - 1103717 abgebildet, das Commitment ist das Produkt aller Einträge.
+// ? Das Produkt ist unabhängig von der Reihenfolge und lässt sich bei jedem Hinzufügen/Entfernen
+// ? eines UTXO in O(1) nachführen (Entfernen multipliziert den Nenner). Anders als eine Summe
+// ? modulo 2^256 lässt es sich nicht mit Wagners Algorithmus auf einen Zielwert bringen.
+// ? Nach außen wird der SHA-256 Hash des Produkts als 32-Byte Commitment-Hash verwendet.
+
+const commitmentTag = "NXT-UTXO-MUHASH-1"
+const commitmentSize = 384 // Bytes, 3072 Bit
+
+var commitmentPrime = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 3072), big.NewInt(1103717))
+
+var numerator = big.NewInt(1)
+var denominator = big.NewInt(1)
+
+func utxoKey(utxo UTXO) string {
+	return fmt.Sprintf("%s:%d", utxo.Txid, utxo.Index)
+}
+
+// ? Key und UTXO werden gemeinsam gehasht und per SHA-256 im Zählermodus auf 3072 Bit erweitert
+func entryElement(key string, utxo UTXO) *big.Int {
+	var e nextutils.Encoder
+	e.PutString(commitmentTag)
+	e.PutString(key)
+	writeUTXO(&e, utxo)
+	seed := sha256.Sum256(e.Bytes())
+
+	expanded := make([]byte, 0, commitmentSize)
+	var block [sha256.Size + 4]byte
+	copy(block[:], seed[:])
+	for counter := uint32(0); len(expanded) < commitmentSize; counter++ {
+		binary.BigEndian.PutUint32(block[sha256.Size:], counter)
+		hash := sha256.Sum256(block[:])
+		expanded = append(expanded, hash[:]...)
+	}
+	element := new(big.Int).SetBytes(expanded)
+	return element.Mod(element, commitmentPrime)
+}
+
+func formatCommitment(product *big.Int) string {
+	hash := sha256.Sum256(product.FillBytes(make([]byte, commitmentSize)))
+	return fmt.Sprintf("%x", hash)
+}
+
+// * CHECK UTXO KEYS * //
+// ? Jeder Key muss Txid:Index seines UTXO sein, sonst könnte ein Set unter falschen Keys
+// ? dasselbe Commitment haben wie das echte
+
+func CheckUTXOKeys(utxos map[string]UTXO) error {
+	for key, utxo := range utxos {
+		if expected := utxoKey(utxo); key != expected {
+			return fmt.Errorf("utxo key %s does not match %s", key, expected)
+		}
+	}
+	return nil
+}
+
+// * COMMITMENT OF ANY SET * //
+
+func CommitmentHash(utxos map[string]UTXO) string {
+	product := big.NewInt(1)
+	for key, utxo := range utxos {
+		product.Mul(product, entryElement(key, utxo))
+		product.Mod(product, commitmentPrime)
+	}
+	return formatCommitment(product)
+}
+
+// * COMMITMENT OF CURRENT DATABASE * //
+
+func Commitment() string {
+	utxoMutex.Lock()
+	defer utxoMutex.Unlock()
+	return currentCommitment()
+}
+
+// ? Der Aufrufer muss utxoMutex halten
+func currentCommitment() string {
+	product := new(big.Int).ModInverse(denominator, commitmentPrime)
+	product.Mul(product, numerator)
+	return formatCommitment(product.Mod(product, commitmentPrime))
+}
+
+// ? Die folgenden Funktionen ändern UTXODatabase und führen das Commitment nach.
+// ? Der Aufrufer muss utxoMutex halten.
+
+func putUTXO(key string, utxo UTXO) {
+	if old, exists := UTXODatabase[key]; exists {
+		denominator.Mul(denominator, entryElement(key, old))
+		denominator.Mod(denominator, commitmentPrime)
+	}
+	UTXODatabase[key] = utxo
+	numerator.Mul(numerator, entryElement(key, utxo))
+	numerator.Mod(numerator, commitmentPrime)
+}
+
+func removeUTXO(key string) {
+	old, exists := UTXODatabase[key]
+	if !exists {
+		return
+	}
+	delete(UTXODatabase, key)
+	denominator.Mul(denominator, entryElement(key, old))
+	denominator.Mod(denominator, commitmentPrime)
+}
+
+func setDatabase(utxos map[string]UTXO) {
+	UTXODatabase = utxos
+	numerator = big.NewInt(1)
+	denominator = big.NewInt(1)
+	for key, utxo := range utxos {
+		numerator.Mul(numerator, entryElement(key, utxo))
+		numerator.Mod(numerator, commitmentPrime)
+	}
+}
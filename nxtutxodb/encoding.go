@@ -0,0 +1,139 @@
+package nxtutxodb
+
+import (
+	"fmt"
+	"nxtchain/nextutils"
+	"sort"
+)
+
+// * BINARY ENCODING * //
+// ? Versionierte Binärkodierung für UTXOs und UTXO Sets (Snapshot und Peer-Sync).
+// ? UTXO: Txid, Index, Amount, PubKey, BlockHeight, IsHeadTransaction. Ein Set wird als Anzahl
+// ? plus (Key, UTXO) Paare nach Key sortiert kodiert, damit gleiche Sets gleiche Bytes ergeben.
+
+func writeUTXO(e *nextutils.Encoder, utxo UTXO) {
+	e.PutString(utxo.Txid)
+	e.PutVarint(int64(utxo.Index))
+	e.PutVarint(utxo.Amount)
+	e.PutString(utxo.PubKey)
+	e.PutVarint(int64(utxo.BlockHeight))
+	e.PutBool(utxo.IsHeadTransaction)
+}
+
+func readUTXO(d *nextutils.Decoder) UTXO {
+	return UTXO{
+		Txid:              d.String(),
+		Index:             int(d.Varint()),
+		Amount:            d.Varint(),
+		PubKey:            d.String(),
+		BlockHeight:       int(d.Varint()),
+		IsHeadTransaction: d.Bool(),
+	}
+}
+
+func writeUTXOMap(e *nextutils.Encoder, utxos map[string]UTXO) {
+	keys := make([]string, 0, len(utxos))
+	for key := range utxos {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	e.PutUvarint(uint64(len(keys)))
+	for _, key := range keys {
+		e.PutString(key)
+		writeUTXO(e, utxos[key])
+	}
+}
+
+func readUTXOMap(d *nextutils.Decoder) map[string]UTXO {
+	count := d.Count()
+	utxos := make(map[string]UTXO, count)
+	for i := 0; i < count && d.Err() == nil; i++ {
+		key := d.String()
+		utxos[key] = readUTXO(d)
+	}
+	return utxos
+}
+
+func readVersion(d *nextutils.Decoder) error {
+	if version := d.Byte(); d.Err() == nil && version != nextutils.EncodingVersion {
+		return fmt.Errorf("unsupported encoding version %d", version)
+	}
+	return d.Err()
+}
+
+// * ENCODE / DECODE UTXO * //
+
+func EncodeUTXO(utxo UTXO) []byte {
+	var e nextutils.Encoder
+	e.PutByte(nextutils.EncodingVersion)
+	writeUTXO(&e, utxo)
+	return e.Bytes()
+}
+
+func DecodeUTXO(data []byte) (UTXO, error) {
+	d := nextutils.NewDecoder(data)
+	if err := readVersion(d); err != nil {
+		return UTXO{}, err
+	}
+	utxo := readUTXO(d)
+	if err := d.Finish(); err != nil {
+		return UTXO{}, fmt.Errorf("invalid utxo encoding: %v", err)
+	}
+	return utxo, nil
+}
+
+// * ENCODE / DECODE UTXO SET * //
+
+func EncodeUTXOMap(utxos map[string]UTXO) []byte {
+	var e nextutils.Encoder
+	e.PutByte(nextutils.EncodingVersion)
+	writeUTXOMap(&e, utxos)
+	return e.Bytes()
+}
+
+func DecodeUTXOMap(data []byte) (map[string]UTXO, error) {
+	d := nextutils.NewDecoder(data)
+	if err := readVersion(d); err != nil {
+		return nil, err
+	}
+	utxos := readUTXOMap(d)
+	if err := d.Finish(); err != nil {
+		return nil, fmt.Errorf("invalid utxo set encoding: %v", err)
+	}
+	if err := CheckUTXOKeys(utxos); err != nil {
+		return nil, fmt.Errorf("invalid utxo set encoding: %v", err)
+	}
+	return utxos, nil
+}
+
+// * ENCODE / DECODE SNAPSHOT * //
+// ? Seq, Source, Tip (Hash, Höhe), UTXO Set. Snapshots älterer Versionen sind JSON.
+
+func encodeSnapshot(snap snapshot) []byte {
+	var e nextutils.Encoder
+	e.PutByte(nextutils.EncodingVersion)
+	e.PutUvarint(snap.Seq)
+	e.PutString(snap.Source)
+	e.PutString(snap.Tip.Hash)
+	e.PutVarint(int64(snap.Tip.Height))
+	writeUTXOMap(&e, snap.UTXOs)
+	return e.Bytes()
+}
+
+func decodeSnapshot(data []byte) (snapshot, error) {
+	d := nextutils.NewDecoder(data)
+	if err := readVersion(d); err != nil {
+		return snapshot{}, err
+	}
+	snap := snapshot{
+		Seq:    d.Uvarint(),
+		Source: d.String(),
+		Tip:    BlockRef{Hash: d.String(), Height: int(d.Varint())},
+		UTXOs:  readUTXOMap(d),
+	}
+	if err := d.Finish(); err != nil {
+		return snapshot{}, err
+	}
+	return snap, nil
+}
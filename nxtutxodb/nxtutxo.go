@@ -34,6 +34,18 @@ func GetUTXOAmount(txid string, index int) (int64, error) {
 	return utxo.Amount, nil
 }
 
+// * GET UTXO * //
+
+func GetUTXO(txid string, index int) (UTXO, bool) {
+	key := fmt.Sprintf("%s:%d", txid, index)
+
+	utxoMutex.Lock()
+	defer utxoMutex.Unlock()
+
+	utxo, exists := UTXODatabase[key]
+	return utxo, exists
+}
+
 // * GET UTXODATABASE * //
 
 func GetUTXODatabase() map[string]UTXO {
@@ -45,11 +57,17 @@ func GetUTXODatabase() map[string]UTXO {
 
 // * SET UTXODATABASE * //
 
-func SetUTXODatabase(utxos map[string]UTXO) {
-	utxoMutex.Lock()
-	defer utxoMutex.Unlock()
+// ? Von Peers übernommenes Set, tip ist der Block, bei dem der Peer das Set gebildet hat.
+// ? Ob tip zur lokalen Kette passt, prüft der Aufrufer (nxtblock.SetPeerUTXODatabase).
 
-	UTXODatabase = utxos
+func SetUTXODatabase(utxos map[string]UTXO, tip BlockRef) error {
+	if err := CheckUTXOKeys(utxos); err != nil {
+		return err
+	}
+	if err := Replace(utxos, SourcePeers, tip); err != nil {
+		return fmt.Errorf("error persisting UTXO database: %v", err)
+	}
+	return nil
 }
 
 // * ADD UTXO TO DATABASE * //
@@ -60,14 +78,14 @@ func AddUTXO(txid string, index int, amount int64, pubKey string, blockHeight in
 	utxoMutex.Lock()
 	defer utxoMutex.Unlock()
 
-	UTXODatabase[key] = UTXO{
+	putUTXO(key, UTXO{
 		Txid:              txid,
 		Index:             index,
 		Amount:            amount,
 		PubKey:            pubKey,
 		BlockHeight:       blockHeight,
 		IsHeadTransaction: isHeadTransaction,
-	}
+	})
 }
 
 func AddUTXOObject(utxo UTXO) {
@@ -76,7 +94,7 @@ func AddUTXOObject(utxo UTXO) {
 	utxoMutex.Lock()
 	defer utxoMutex.Unlock()
 
-	UTXODatabase[key] = utxo
+	putUTXO(key, utxo)
 }
 
 // * REMOVE UTXO FROM DATABASE * //
@@ -87,7 +105,7 @@ func RemoveUTXO(txid string, index int) {
 	utxoMutex.Lock()
 	defer utxoMutex.Unlock()
 
-	delete(UTXODatabase, key)
+	removeUTXO(key)
 }
 
 // * GET UTXO FROM DATABASE BY WALLET ADDR * //
@@ -105,3 +123,39 @@ func GetUTXOByWalletAddr(walletAddr string) []UTXO {
 
 	return utxos
 }
+
+// * APPLY CHANGES (nur im Speicher, ohne Journal) * //
+
+func ApplyChanges(spent []string, created []UTXO) {
+	utxoMutex.Lock()
+	defer utxoMutex.Unlock()
+
+	for _, key := range spent {
+		removeUTXO(key)
+	}
+	for _, utxo := range created {
+		putUTXO(fmt.Sprintf("%s:%d", utxo.Txid, utxo.Index), utxo)
+	}
+}
+
+// * CLEAR DATABASE (nur im Speicher, ohne Journal) * //
+
+func ClearUTXODatabase() {
+	utxoMutex.Lock()
+	defer utxoMutex.Unlock()
+
+	setDatabase(make(map[string]UTXO))
+}
+
+// * COPY DATABASE * //
+
+func CopyUTXODatabase() map[string]UTXO {
+	utxoMutex.Lock()
+	defer utxoMutex.Unlock()
+
+	utxos := make(map[string]UTXO, len(UTXODatabase))
+	for key, utxo := range UTXODatabase {
+		utxos[key] = utxo
+	}
+	return utxos
+}
@@ -0,0 +1,279 @@
+package nxtutxodb
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"nxtchain/nextutils"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// * PERSISTENZ * //
+// ? Die UTXO Datenbank wird als Snapshot (utxo.snapshot) plus append-only Journal (utxo.journal)
+// ? gespeichert. Jeder Journal-Eintrag enthält die Änderungen eines Blocks (verbrauchte Keys,
+// ? neue UTXOs). Beim Start wird der Snapshot geladen und das Journal darauf abgespielt.
+// ? Der Snapshot ist binär kodiert (encoding.go), ältere JSON Snapshots werden weiter gelesen.
+
+const snapshotFile = "utxo.snapshot"
+const journalFile = "utxo.journal"
+
+const SourceBlocks = "blocks"
+const SourcePeers = "peers"
+
+type BlockRef struct {
+	Hash   string `json:"hash"`
+	Height int    `json:"height"`
+}
+
+type snapshot struct {
+	Seq    uint64          `json:"seq"`
+	Source string          `json:"source"`
+	Tip    BlockRef        `json:"tip"`
+	UTXOs  map[string]UTXO `json:"utxos"`
+}
+
+type JournalEntry struct {
+	Seq      uint64   `json:"seq"`
+	Block    BlockRef `json:"block"`
+	Spent    []string `json:"spent"`
+	Created  []UTXO   `json:"created"`
+	Reverted string   `json:"reverted,omitempty"` // Hash des entfernten Blocks (Block ist dann der neue Tip)
+}
+
+var SnapshotInterval = 100
+
+var persistMutex sync.Mutex
+var persistDir string
+var persistSeq uint64
+var persistSource = SourceBlocks
+var snapshotTip BlockRef
+var journalEntries []JournalEntry
+var tip BlockRef
+
+// * OPEN DATABASE * //
+// ? Lädt Snapshot + Journal aus dir. Ohne vorhandene Dateien startet die Datenbank leer.
+
+func Open(dir string) error {
+	persistMutex.Lock()
+	defer persistMutex.Unlock()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating utxo directory: %v", err)
+	}
+	nextutils.RemoveTempFiles(dir)
+
+	snap := snapshot{Source: SourceBlocks, UTXOs: make(map[string]UTXO)}
+	data, err := os.ReadFile(filepath.Join(dir, snapshotFile))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading utxo snapshot: %v", err)
+	}
+	if err == nil {
+		if len(data) > 0 && data[0] == '{' {
+			err = json.Unmarshal(data, &snap)
+		} else {
+			snap, err = decodeSnapshot(data)
+		}
+		if err == nil {
+			err = CheckUTXOKeys(snap.UTXOs)
+		}
+		if err != nil {
+			return fmt.Errorf("error parsing utxo snapshot: %v", err)
+		}
+		if snap.UTXOs == nil {
+			snap.UTXOs = make(map[string]UTXO)
+		}
+	}
+
+	entries, err := readJournal(dir)
+	if err != nil {
+		return err
+	}
+
+	utxos := snap.UTXOs
+	current := snap.Tip
+	seq := snap.Seq
+	var replayed []JournalEntry
+	for _, entry := range entries {
+		if entry.Seq <= snap.Seq {
+			continue
+		}
+		applyChanges(utxos, entry.Spent, entry.Created)
+		current = entry.Block
+		seq = entry.Seq
+		replayed = append(replayed, entry)
+	}
+
+	utxoMutex.Lock()
+	setDatabase(utxos)
+	utxoMutex.Unlock()
+
+	persistDir = dir
+	persistSeq = seq
+	persistSource = snap.Source
+	snapshotTip = snap.Tip
+	journalEntries = replayed
+	tip = current
+
+	nextutils.Debug("UTXO database loaded: %d entries, tip %s (height %d), %d journal entries", len(utxos), tip.Hash, tip.Height, len(replayed))
+	return nil
+}
+
+func readJournal(dir string) ([]JournalEntry, error) {
+	file, err := os.Open(filepath.Join(dir, journalFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading utxo journal: %v", err)
+	}
+	defer file.Close()
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// ? Eine abgeschnittene letzte Zeile stammt von einem Absturz während des Schreibens
+			nextutils.Error("Skipping damaged utxo journal entry: %v", err)
+			break
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading utxo journal: %v", err)
+	}
+	return entries, nil
+}
+
+func applyChanges(utxos map[string]UTXO, spent []string, created []UTXO) {
+	for _, key := range spent {
+		delete(utxos, key)
+	}
+	for _, utxo := range created {
+		utxos[fmt.Sprintf("%s:%d", utxo.Txid, utxo.Index)] = utxo
+	}
+}
+
+// * APPLY BLOCK * //
+// ? Übernimmt die UTXO Änderungen eines Blocks und schreibt sie ins Journal
+
+func ApplyBlock(block BlockRef, spent []string, created []UTXO) error {
+	ApplyChanges(spent, created)
+	return journalChanges(JournalEntry{Block: block, Spent: spent, Created: created})
+}
+
+// * REVERT BLOCK * //
+// ? Nimmt die Änderungen eines Blocks zurück (removed = vom Block erzeugte Keys, restored = von ihm
+// ? verbrauchte UTXOs aus den Undo-Daten). parent ist danach der neue Tip.
+
+func RevertBlock(reverted string, parent BlockRef, removed []string, restored []UTXO) error {
+	ApplyChanges(removed, restored)
+	return journalChanges(JournalEntry{Block: parent, Spent: removed, Created: restored, Reverted: reverted})
+}
+
+func journalChanges(entry JournalEntry) error {
+	persistMutex.Lock()
+	defer persistMutex.Unlock()
+
+	tip = entry.Block
+	if persistDir == "" {
+		return nil
+	}
+
+	entry.Seq = persistSeq + 1
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := nextutils.AppendFileSync(filepath.Join(persistDir, journalFile), append(line, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing utxo journal: %v", err)
+	}
+	persistSeq = entry.Seq
+	journalEntries = append(journalEntries, entry)
+
+	if SnapshotInterval > 0 && len(journalEntries) >= SnapshotInterval {
+		return writeSnapshot()
+	}
+	return nil
+}
+
+// * SNAPSHOT * //
+
+func Snapshot() error {
+	persistMutex.Lock()
+	defer persistMutex.Unlock()
+
+	if persistDir == "" {
+		return nil
+	}
+	return writeSnapshot()
+}
+
+func writeSnapshot() error {
+	utxos := CopyUTXODatabase()
+
+	data := encodeSnapshot(snapshot{Seq: persistSeq, Source: persistSource, Tip: tip, UTXOs: utxos})
+	if err := nextutils.WriteFileAtomic(filepath.Join(persistDir, snapshotFile), data, 0644); err != nil {
+		return fmt.Errorf("error writing utxo snapshot: %v", err)
+	}
+	// ? Einträge bis persistSeq sind jetzt im Snapshot enthalten
+	if err := os.Remove(filepath.Join(persistDir, journalFile)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error truncating utxo journal: %v", err)
+	}
+	snapshotTip = tip
+	journalEntries = nil
+	nextutils.Debug("UTXO snapshot written: %d entries at %s (height %d)", len(utxos), tip.Hash, tip.Height)
+	return nil
+}
+
+// * TIP * //
+// ? Letzter Block, dessen Änderungen in der Datenbank enthalten sind
+
+func Tip() BlockRef {
+	persistMutex.Lock()
+	defer persistMutex.Unlock()
+	return tip
+}
+
+// * SOURCE * //
+// ? "blocks" wenn die Datenbank aus lokalen Blöcken entstanden ist, "peers" nach einem Peer-Sync
+
+func Source() string {
+	persistMutex.Lock()
+	defer persistMutex.Unlock()
+	return persistSource
+}
+
+// * APPLIED BLOCKS * //
+// ? Snapshot-Block und alle seither journalisierten Blöcke (für die Verifikation gegen die Blockdateien)
+
+func AppliedBlocks() (BlockRef, []JournalEntry) {
+	persistMutex.Lock()
+	defer persistMutex.Unlock()
+	entries := make([]JournalEntry, len(journalEntries))
+	copy(entries, journalEntries)
+	return snapshotTip, entries
+}
+
+// * REPLACE DATABASE * //
+// ? Ersetzt die komplette Datenbank (Peer-Sync oder Reindex) und schreibt sofort einen Snapshot
+
+func Replace(utxos map[string]UTXO, source string, at BlockRef) error {
+	utxoMutex.Lock()
+	setDatabase(utxos)
+	utxoMutex.Unlock()
+
+	persistMutex.Lock()
+	defer persistMutex.Unlock()
+
+	persistSource = source
+	tip = at
+	if persistDir == "" {
+		return nil
+	}
+	persistSeq++
+	return writeSnapshot()
+}
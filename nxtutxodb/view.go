@@ -0,0 +1,138 @@
+package nxtutxodb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// * UTXO VIEW * //
+// ? Copy-on-write Sicht auf die UTXO Datenbank für die Validierung. Gelesen wird aus der
+// ? Datenbank, solange ein Eintrag in der Sicht nicht geändert wurde. Änderungen bleiben in der
+// ? Sicht, bis Commit sie als Block übernimmt. Eine verworfene Sicht hinterlässt keine Spuren.
+// ? NewMapView liest statt der Datenbank ein privates Set (Reindex, Verify), das nur ApplyTo ändert.
+
+type View struct {
+	base    BlockRef        // Tip der Datenbank beim Erstellen der Sicht
+	source  map[string]UTXO // privates Set statt der Datenbank (nil: Datenbank)
+	utxos   map[string]UTXO // in der Sicht erstellt
+	spent   map[string]bool // in der Sicht ausgegeben
+	order   []string        // Reihenfolge der ausgegebenen Keys (für das Journal)
+	created []string        // Reihenfolge der erstellten Keys (für das Journal)
+}
+
+func NewView() *View {
+	return &View{
+		base:  Tip(),
+		utxos: make(map[string]UTXO),
+		spent: make(map[string]bool),
+	}
+}
+
+// ? Sicht auf ein privates Set, die Datenbank wird weder gelesen noch verändert
+func NewMapView(utxos map[string]UTXO) *View {
+	return &View{
+		source: utxos,
+		utxos:  make(map[string]UTXO),
+		spent:  make(map[string]bool),
+	}
+}
+
+// * GET UTXO (VIEW) * //
+
+func (v *View) Get(txid string, index int) (UTXO, bool) {
+	key := fmt.Sprintf("%s:%d", txid, index)
+	if v.spent[key] {
+		return UTXO{}, false
+	}
+	if utxo, exists := v.utxos[key]; exists {
+		return utxo, true
+	}
+	if v.source != nil {
+		utxo, exists := v.source[key]
+		return utxo, exists
+	}
+	return GetUTXO(txid, index)
+}
+
+func (v *View) Amount(txid string, index int) (int64, error) {
+	utxo, exists := v.Get(txid, index)
+	if !exists {
+		return 0, errors.New("UTXO not found")
+	}
+	return utxo.Amount, nil
+}
+
+// * SPEND UTXO (VIEW) * //
+
+func (v *View) Spend(txid string, index int) error {
+	key := fmt.Sprintf("%s:%d", txid, index)
+	if _, exists := v.Get(txid, index); !exists {
+		return fmt.Errorf("UTXO %s not found or already spent", key)
+	}
+	// ? In der Sicht erstellt und wieder ausgegeben: die Datenbank sieht davon nichts
+	if _, exists := v.utxos[key]; exists {
+		delete(v.utxos, key)
+		for i, created := range v.created {
+			if created == key {
+				v.created = append(v.created[:i], v.created[i+1:]...)
+				break
+			}
+		}
+		return nil
+	}
+	v.spent[key] = true
+	v.order = append(v.order, key)
+	return nil
+}
+
+// * ADD UTXO (VIEW) * //
+
+func (v *View) Add(utxo UTXO) error {
+	key := fmt.Sprintf("%s:%d", utxo.Txid, utxo.Index)
+	if _, exists := v.Get(utxo.Txid, utxo.Index); exists {
+		return fmt.Errorf("UTXO %s already exists", key)
+	}
+	v.utxos[key] = utxo
+	v.created = append(v.created, key)
+	return nil
+}
+
+// * CHANGES (VIEW) * //
+// ? Ausgegebene Keys und neue UTXOs in der Reihenfolge, in der sie der Sicht hinzugefügt wurden
+
+func (v *View) Changes() ([]string, []UTXO) {
+	spent := append([]string(nil), v.order...)
+	created := make([]UTXO, 0, len(v.created))
+	for _, key := range v.created {
+		created = append(created, v.utxos[key])
+	}
+	return spent, created
+}
+
+// * COMMIT (VIEW) * //
+// ? Übernimmt die Änderungen als Block in die Datenbank (mit Journal). Die Datenbank darf sich
+// ? seit dem Erstellen der Sicht nicht verändert haben.
+
+func (v *View) Commit(block BlockRef) error {
+	if v.source != nil {
+		return errors.New("a view on a private utxo set cannot be committed to the database")
+	}
+	if tip := Tip(); tip != v.base {
+		return fmt.Errorf("utxo database moved from %s to %s since the view was created", v.base.Hash, tip.Hash)
+	}
+	spent, created := v.Changes()
+	return ApplyBlock(block, spent, created)
+}
+
+// * APPLY TO (VIEW) * //
+// ? Übernimmt die Änderungen in ein privates Set (für Sichten aus NewMapView)
+
+func (v *View) ApplyTo(utxos map[string]UTXO) {
+	spent, created := v.Changes()
+	for _, key := range spent {
+		delete(utxos, key)
+	}
+	for _, utxo := range created {
+		utxos[fmt.Sprintf("%s:%d", utxo.Txid, utxo.Index)] = utxo
+	}
+}
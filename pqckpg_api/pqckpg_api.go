@@ -76,6 +76,10 @@ func Verify(publicKey []byte, message []byte, signature []byte) bool {
 	return dilithiumInstance.Verify(dilithiumPK, message, signature)
 }
 
+func SignatureSize() int {
+	return dilithiumInstance.SIZESIG()
+}
+
 func Match(publicKey []byte, privateKey []byte) bool {
 	dilithiumPK, _ := splitKey(publicKey)
 	dilithiumSK, _ := splitKey(privateKey)
@@ -116,23 +116,43 @@ func start(Peer *gonetic.Peer, msg ...string) {
 		fmt.Print("TO: ") // Wallet receiving address
 		var to string
 		fmt.Scanln(&to)
-		fmt.Print("AMOUNT: ") // Amount to send
-		var amount float64    // * Amount * 1.000.000.000.000
-		fmt.Scanln(&amount)
-		fmt.Print("FEE (OPTIONAL > 0) IN % 0-100: ") // Fee percentage
-		var fee int64                                // * Fee PERCENTAGE *
-		fmt.Scanln(&fee)
+		fmt.Print("AMOUNT: ")  // Amount to send
+		var amountInput string // * Amount in NXT (exact decimal, e.g. 1.25) *
+		fmt.Scanln(&amountInput)
+		amount, err := nxtblock.ParseAmount(amountInput)
+		if err != nil || amount <= 0 {
+			fmt.Println("Invalid amount")
+			start(Peer)
+			return
+		}
+		fmt.Printf("FEE RATE PER BYTE (OPTIONAL, DEFAULT %d): ", int64(nxtblock.DefaultMinRelayFeeRate))
+		var feeRateInput string // * Base units per byte of the signed transaction *
+		fmt.Scanln(&feeRateInput)
+		feeRate := nxtblock.DefaultMinRelayFeeRate
+		if feeRateInput != "" {
+			rate, err := strconv.ParseInt(feeRateInput, 10, 64)
+			if err != nil || rate < 0 {
+				fmt.Println("Invalid fee rate")
+				start(Peer)
+				return
+			}
+			feeRate = nxtblock.Amount(rate)
+		}
 
 		walletAddr := walletAddresses[walletIndex]
+		wallet, err := nxtblock.LoadWallet(walletAddr, walletdir)
+		if err != nil {
+			nextutils.Error("Error loading wallet: %v", err)
+			return
+		}
 		fmt.Println("=====================================")
 		fmt.Println("FROM:              ", walletAddr)
 		fmt.Println("TO:                ", to)
-		fmt.Println("AMOUNT IN NXT:     ", nxtblock.ConvertAmountBack(amount))
-		fmt.Println("AMOUNT RAW:        ", amount)
-		fmt.Println("FEE:               ", fmt.Sprintf("%d%%", fee))
-		fmt.Printf("FEE IN NXT:         %d\n", int64(float64(nxtblock.ConvertAmountBack(amount))*(float64(fee)/100)))
+		fmt.Println("AMOUNT IN NXT:     ", amount)
+		fmt.Println("AMOUNT RAW:        ", int64(amount))
+		fmt.Println("FEE RATE:          ", fmt.Sprintf("%d per byte", int64(feeRate)))
 		fmt.Println("=====================================")
-		nextutils.Debug("%s", "Transaction details: "+fmt.Sprintf("FROM: %s, TO: %s, AMOUNT: %f, FEE: %d", walletAddr, to, amount, fee))
+		nextutils.Debug("%s", "Transaction details: "+fmt.Sprintf("FROM: %s, TO: %s, AMOUNT: %s, FEE RATE: %d", walletAddr, to, amount, int64(feeRate)))
 
 		nextutils.Debug("%s", "Requesting unspent transaction outputs (UTXOs) for wallet: "+walletAddr)
 		getInputs(Peer, walletAddr)
@@ -155,10 +175,10 @@ func start(Peer *gonetic.Peer, msg ...string) {
 
 		nextutils.Debug("%s", "Received inputs: "+fmt.Sprintf("%v", inputs))
 
-		feeAmount := (nxtblock.ConvertAmountBack(amount) * fee) / 100
-		totalNeeded := nxtblock.ConvertAmountBack(amount) + feeAmount
 		var selectedInputs []nxtutxodb.UTXO
-		var totalAmount int64 = 0
+		var totalAmount nxtblock.Amount
+		var feeAmount nxtblock.Amount
+		totalNeeded := amount
 
 		sort.Slice(inputs, func(i, j int) bool {
 			return inputs[i].Amount > inputs[j].Amount
@@ -166,23 +186,39 @@ func start(Peer *gonetic.Peer, msg ...string) {
 
 		for _, input := range inputs {
 			selectedInputs = append(selectedInputs, input)
-			totalAmount += input.Amount
+			if totalAmount, err = totalAmount.Add(nxtblock.Amount(input.Amount)); err != nil {
+				nextutils.Error("Error adding inputs: %v", err)
+				start(Peer)
+				return
+			}
+			// ? The fee depends on the size, so it grows with every selected input
+			if feeAmount, err = estimateFee(selectedInputs, amount, to, walletAddr, wallet.PublicKey, feeRate); err != nil {
+				nextutils.Error("Error calculating fee: %v", err)
+				start(Peer)
+				return
+			}
+			if totalNeeded, err = amount.Add(feeAmount); err != nil {
+				nextutils.Error("Error calculating fee: %v", err)
+				start(Peer)
+				return
+			}
 			if totalAmount >= totalNeeded {
 				break
 			}
 		}
 
 		if totalAmount < totalNeeded {
-			fmt.Printf("ERROR: Insufficient funds (%.8f NXT required, have %.8f NXT)\n",
-				float64(totalNeeded),
-				float64(totalAmount))
+			fmt.Printf("ERROR: Insufficient funds (%s NXT required, have %s NXT)\n",
+				totalNeeded,
+				totalAmount)
 			start(Peer)
 			return
 		}
 
-		change := totalAmount - totalNeeded
+		fmt.Printf("FEE IN NXT:         %s\n", feeAmount)
+		change, _ := totalAmount.Sub(totalNeeded)
 		if change > 0 {
-			fmt.Printf("Change amount: %.8f NXT\n", float64(change))
+			fmt.Printf("Change amount: %s NXT\n", change)
 		}
 
 		fmt.Printf("Selected %d inputs for transaction\n", len(selectedInputs))
@@ -191,7 +227,7 @@ func start(Peer *gonetic.Peer, msg ...string) {
 		var tInputs []nxtblock.TInput
 		var tOutputs []nxtblock.TOutput
 
-		tOutput := nxtblock.CreateTransactionOutput(0, nxtblock.ConvertAmountBack(amount), to)
+		tOutput := nxtblock.CreateTransactionOutput(0, amount, to)
 		tOutputs = append(tOutputs, tOutput)
 
 		if change > 0 {
@@ -208,19 +244,13 @@ func start(Peer *gonetic.Peer, msg ...string) {
 			return
 		}
 
-		tx := nxtblock.PrepareTransaction(tOutputs)
-
 		for _, input := range selectedInputs {
-			wallet, err := nxtblock.LoadWallet(walletAddr, walletdir)
-			if err != nil {
-				nextutils.Error("Error loading wallet: %v", err)
-				return
-			}
-			tInput := nxtblock.CreateTransactionInput(input.Txid, input.Index, []byte(wallet.PrivateKey), []byte(wallet.PublicKey), tx.Hash)
+			tInput := nxtblock.CreateTransactionInput(input.Txid, input.Index, []byte(wallet.PublicKey))
 			tInputs = append(tInputs, tInput)
 		}
 
-		tx.Inputs = tInputs
+		tx := nxtblock.PrepareTransaction(tInputs, tOutputs)
+		tx = nxtblock.SignTransaction(tx, []byte(wallet.PrivateKey))
 
 		// txJSON, _ := json.Marshal(tx)
 		// fmt.Printf("Transaction JSON: %s\n", string(txJSON))
@@ -291,8 +321,12 @@ func start(Peer *gonetic.Peer, msg ...string) {
 			nextutils.Error("Error retrieving UTXOs: %v", err)
 			return
 		}
-		amount := nxtblock.ConvertAmount(CalculateBalance(rutxos))
-		start(Peer, fmt.Sprintf("%s | BALANCE: %f NXT", walletAddresses[walletIndex], amount))
+		amount, err := CalculateBalance(rutxos)
+		if err != nil {
+			nextutils.Error("Error calculating balance: %v", err)
+			return
+		}
+		start(Peer, fmt.Sprintf("%s | BALANCE: %s NXT", walletAddresses[walletIndex], amount))
 
 	case 4:
 		wallets, err := nxtblock.GetAllWallets(walletdir)
@@ -336,7 +370,7 @@ func start(Peer *gonetic.Peer, msg ...string) {
 
 		formattedTransactions := make([]string, 0)
 		for _, tx := range transactions {
-			formattedTransactions = append(formattedTransactions, fmt.Sprintf("TXID: %s | %s -> %s | AMOUNT: %f NXT", tx.Hash, tx.Inputs[0].PublicKey, tx.Outputs[0].ReceiverAddr, nxtblock.ConvertAmount(tx.Outputs[0].Amount)))
+			formattedTransactions = append(formattedTransactions, fmt.Sprintf("TXID: %s | %s -> %s | AMOUNT: %s NXT", tx.Hash, tx.Inputs[0].PublicKey, tx.Outputs[0].ReceiverAddr, nxtblock.Amount(tx.Outputs[0].Amount)))
 		}
 
 		start(Peer, formattedTransactions...)
@@ -375,14 +409,34 @@ func getInputs(Peer *gonetic.Peer, walletAddr string) {
 	Peer.Broadcast("RGET_INPUTS_" + walletAddr + "_" + Peer.GetConnString())
 }
 
+// * ESTIMATE FEE * //
+// ? Fee for the signed transaction with the selected inputs, the payment and a change output
+// ? (feeRate base units per byte). The change is sized with MaxAmount as an upper bound.
+
+func estimateFee(selectedInputs []nxtutxodb.UTXO, amount nxtblock.Amount, to string, walletAddr string, publicKey []byte, feeRate nxtblock.Amount) (nxtblock.Amount, error) {
+	var tInputs []nxtblock.TInput
+	for _, input := range selectedInputs {
+		tInputs = append(tInputs, nxtblock.CreateTransactionInput(input.Txid, input.Index, publicKey))
+	}
+	tOutputs := []nxtblock.TOutput{
+		nxtblock.CreateTransactionOutput(0, amount, to),
+		nxtblock.CreateTransactionOutput(1, nxtblock.MaxAmount, walletAddr),
+	}
+	size := nxtblock.EstimateTransactionSize(nxtblock.PrepareTransaction(tInputs, tOutputs))
+	return nxtblock.CalculateFeeForSize(size, feeRate)
+}
+
 // * CALCULATE BALANCE * //
 
-func CalculateBalance(inputs []nxtutxodb.UTXO) int64 {
-	var balance int64
+func CalculateBalance(inputs []nxtutxodb.UTXO) (nxtblock.Amount, error) {
+	var balance nxtblock.Amount
 	for _, input := range inputs {
-		balance += input.Amount
+		var err error
+		if balance, err = balance.Add(nxtblock.Amount(input.Amount)); err != nil {
+			return 0, err
+		}
 	}
-	return balance
+	return balance, nil
 }
 
 // * RETRIEVE INPUTS FROM UTXO JSON * //